@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"lazyboy/queue"
+	"os"
+	"path"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+var ErrUsage = errors.New(`usage: lazyboy [-d queuebase] <command>
+
+commands:
+  dead requeue <pipeline> [category]          move dead-lettered items back into the queue
+  pos show <pipeline>                         show offset and progress of each queue file
+  pos rewind <pipeline> <file> line <n>       read the file again from the n-th line
+  pos rewind <pipeline> <file> offset <n>     read the file again from the byte offset n
+  pos rewind <pipeline> <file> key <key>      read the file again from the first item with the UniqueKey
+  pos clear <pipeline> <file>                 clear LastError so the file is read again
+  quarantine list <pipeline>                  show quarantined queue files and why
+  quarantine resume <pipeline> <file>         move a fixed file back and read it again from the bad line
+  quarantine skip <pipeline> <file>           move a file back and read it again after the bad line`)
+
+// runCommand 는 데몬 대신 한번 실행하고 끝나는 관리용 명령을 처리한다.
+func runCommand(pipeBasePath string, args []string) error {
+	if len(args) < 2 {
+		return ErrUsage
+	}
+	switch args[0] + " " + args[1] {
+	case "dead requeue":
+		if len(args) < 3 {
+			return ErrUsage
+		}
+		var category queue.DeadCategory
+		if len(args) > 3 {
+			category = queue.DeadCategory(args[3])
+		}
+		// 돌고 있는 proc 이 쓰고 있는 dead letter 파일을 옮기지 않도록 끝나기를 기다린다.
+		return withPipelineLock(pipeBasePath, args[2], func(pipe *queue.Pipeline) error {
+			n, err := pipe.RequeueDeadLetters(category)
+			fmt.Printf("requeued %v items\n", n)
+			return err
+		})
+	case "pos show":
+		if len(args) != 3 {
+			return ErrUsage
+		}
+		pipe, err := queue.NewPipelineFromConfigPath(path.Join(pipeBasePath, args[2], "config.json"))
+		if err != nil {
+			return err
+		}
+		positions, err := pipe.QueuePositions()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "FILE\tOFFSET\tDONE\tREST\tPROGRESS\tLASTERROR")
+		for _, p := range positions {
+			if p.Error != "" {
+				fmt.Fprintf(w, "%v\t-\t-\t-\t-\t%v\n", p.Name, p.Error)
+				continue
+			}
+			var progress float64 = 100
+			if total := p.Done + p.Rest; total > 0 {
+				progress = float64(p.Done) * 100 / float64(total)
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%.1f%%\t%v\n", p.Name, p.Pos.Offset, p.Done, p.Rest, progress, p.Pos.LastError)
+		}
+		return w.Flush()
+	case "pos rewind":
+		if len(args) != 6 {
+			return ErrUsage
+		}
+		return withPipelineLock(pipeBasePath, args[2], func(pipe *queue.Pipeline) error {
+			var offset int64
+			var err error
+			switch args[4] {
+			case "line", "offset":
+				var n int64
+				n, err = strconv.ParseInt(args[5], 10, 64)
+				if err != nil {
+					return err
+				}
+				if args[4] == "line" {
+					offset, err = pipe.RewindLine(args[3], n)
+				} else {
+					offset, err = pipe.RewindOffset(args[3], n)
+				}
+			case "key":
+				offset, err = pipe.RewindKey(args[3], args[5])
+			default:
+				return ErrUsage
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%v will be read from offset %v\n", args[3], offset)
+			if pipe.Dedup.Enabled {
+				fmt.Println("Dedup is enabled. Items succeeded within Dedup.Window are skipped")
+			}
+			return nil
+		})
+	case "pos clear":
+		if len(args) != 4 {
+			return ErrUsage
+		}
+		return withPipelineLock(pipeBasePath, args[2], func(pipe *queue.Pipeline) error {
+			err := pipe.ClearLastError(args[3])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("cleared LastError of %v\n", args[3])
+			return nil
+		})
+	case "quarantine list":
+		if len(args) != 3 {
+			return ErrUsage
+		}
+		pipe, err := queue.NewPipelineFromConfigPath(path.Join(pipeBasePath, args[2], "config.json"))
+		if err != nil {
+			return err
+		}
+		reports, err := pipe.QuarantinedFiles()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "FILE\tOFFSET\tAT\tERROR")
+		for _, r := range reports {
+			at := ""
+			if !r.At.IsZero() {
+				at = r.At.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", r.Name, r.Offset, at, r.Error)
+		}
+		return w.Flush()
+	case "quarantine resume", "quarantine skip":
+		if len(args) != 4 {
+			return ErrUsage
+		}
+		return withPipelineLock(pipeBasePath, args[2], func(pipe *queue.Pipeline) error {
+			offset, err := pipe.ResumeQuarantined(args[3], args[1] == "skip")
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%v will be read from offset %v\n", args[3], offset)
+			return nil
+		})
+	}
+	return ErrUsage
+}
+
+// withPipelineLock 은 데몬이 파이프라인을 돌리는 중이면 끝날 때까지 기다렸다가 f 를 부른다.
+// 데몬은 실행마다 pos 를 새로 읽으므로 잠금 안에서 고친 pos 는 다음 실행부터 쓰인다.
+func withPipelineLock(pipeBasePath string, name string, f func(pipe *queue.Pipeline) error) error {
+	pipe, err := queue.NewPipelineFromConfigPath(path.Join(pipeBasePath, name, "config.json"))
+	if err != nil {
+		return err
+	}
+	defer pipe.Close()
+	lock := queue.NewFileLock(pipe.LockPath())
+	locked, err := lock.TryLock()
+	if err != nil {
+		return err
+	}
+	if !locked {
+		fmt.Printf("waiting for the running %v to finish\n", name)
+		err = lock.Lock(context.Background())
+		if err != nil {
+			return err
+		}
+	}
+	defer lock.Unlock()
+	return f(pipe)
+}
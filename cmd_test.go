@@ -0,0 +1,51 @@
+package main
+
+import (
+	"lazyboy/queue"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestDeadRequeueWaitsForRun(t *testing.T) {
+	base := t.TempDir()
+	pipePath := path.Join(base, "orders")
+	deadPath := path.Join(pipePath, queue.DeadLetterDir)
+	_ = os.MkdirAll(deadPath, 0755)
+	_ = os.WriteFile(path.Join(pipePath, "config.json"), []byte(`{"OutputPath":"out.log","UniqueKey":"$.uuid"}`), 0644)
+	deadFile := path.Join(deadPath, "2026-01-01.jsonl")
+	_ = os.WriteFile(deadFile, []byte(`{"Data":"{\"uuid\":\"1\"}","Category":"HTTP"}`+"\n"), 0644)
+
+	// 돌고 있는 proc 처럼 잠금을 잡는다.
+	lock := queue.NewFileLock(path.Join(pipePath, queue.RunLockName))
+	if ok, err := lock.TryLock(); !ok || err != nil {
+		t.Fatalf("TryLock() = %v, %v", ok, err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- runCommand(base, []string{"dead", "requeue", "orders"})
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("requeue did not wait for the run - %v", err)
+	case <-time.After(time.Millisecond * 200):
+	}
+	if _, err := os.Stat(deadFile); err != nil {
+		t.Errorf("dead letter file is moved while running - %v", err)
+	}
+
+	_ = lock.Unlock()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("requeue did not finish after the run")
+	}
+	if dirs, _ := os.ReadDir(deadPath); len(dirs) != 0 {
+		t.Errorf("dead files = %v", len(dirs))
+	}
+}
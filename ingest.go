@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"lazyboy/queue"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// ingestMaxBody 보다 큰 요청은 받지 않는다.
+const ingestMaxBody = 64 << 20
+
+type IngestResult struct {
+	Accepted int
+	Rejected int
+	Errors   []IngestError `json:",omitempty"`
+}
+
+type IngestError struct {
+	Index int
+	Error string
+}
+
+// serveIngest 는 POST /pipelines/{name}/items 로 받은 것을 파이프라인의 큐에 넣는다. ctx 가 끝나면 멈춘다.
+func serveIngest(ctx context.Context, addr string, pipeBasePath string) {
+	logger := logrus.WithContext(ctx)
+	mux := http.NewServeMux()
+	mux.Handle("/pipelines/", ingestHandler(pipeBasePath))
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: time.Second * 10}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	logger.Infof("Ingest listens on %v", addr)
+	err := server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Warnf("Ingest stopped - %v", err)
+	}
+}
+
+// ingestHandler 는 JSON 객체 하나, JSON 배열, NDJSON 을 모두 받는다.
+// 읽는 대로 한 건씩 넣으므로 중간에 문법 오류가 나도 그 앞의 것은 이미 들어가 있다.
+func ingestHandler(pipeBasePath string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := logrus.WithFields(logrus.Fields{"ctx": "ingest", "path": r.URL.Path})
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/pipelines/"), "/")
+		if len(parts) != 2 || parts[1] != "items" || parts[0] == "" || strings.HasPrefix(parts[0], ".") {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		configPath := path.Join(pipeBasePath, parts[0], "config.json")
+		if _, err := os.Stat(configPath); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		pipe, err := queue.NewPipelineFromConfigPath(configPath)
+		if err != nil {
+			logger.Warnf("Can not load config.json - %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer pipe.Close()
+
+		var result IngestResult
+		status := http.StatusOK
+		offer := func(data json.RawMessage) {
+			err := pipe.Offer(data)
+			if err != nil {
+				result.Errors = append(result.Errors, IngestError{Index: result.Accepted + result.Rejected, Error: err.Error()})
+				result.Rejected++
+				return
+			}
+			result.Accepted++
+		}
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, ingestMaxBody))
+		for {
+			var value json.RawMessage
+			err := decoder.Decode(&value)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				// 어디서부터 다시 읽어야 할지 모르므로 여기서 멈춘다.
+				result.Errors = append(result.Errors, IngestError{Index: result.Accepted + result.Rejected, Error: err.Error()})
+				result.Rejected++
+				status = http.StatusBadRequest
+				break
+			}
+			var values []json.RawMessage
+			if json.Unmarshal(value, &values) != nil {
+				values = []json.RawMessage{value}
+			}
+			for _, v := range values {
+				offer(v)
+			}
+		}
+		logger.Infof("Accepted %v, Rejected %v", result.Accepted, result.Rejected)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(result)
+	})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"lazyboy/queue"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newIngestBase(t *testing.T) string {
+	t.Helper()
+	base := t.TempDir()
+	err := os.Mkdir(path.Join(base, "orders"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := `{"TakePerTick": 10, "OutputPath": "./out.log", "UniqueKey": "$.uuid"}`
+	err = os.WriteFile(path.Join(base, "orders", "config.json"), []byte(config), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base
+}
+
+func TestIngestHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		want       IngestResult
+		wantQueued []string
+	}{
+		{name: "object", body: "{\n  \"uuid\": \"1\"\n}", wantStatus: http.StatusOK,
+			want: IngestResult{Accepted: 1}, wantQueued: []string{`{"uuid":"1"}`}},
+		{name: "array", body: `[{"uuid":"1"},{"id":"2"},{"uuid":"3"}]`, wantStatus: http.StatusOK,
+			want:       IngestResult{Accepted: 2, Rejected: 1, Errors: []IngestError{{Index: 1}}},
+			wantQueued: []string{`{"uuid":"1"}`, `{"uuid":"3"}`}},
+		{name: "ndjson", body: "{\"uuid\":\"1\"}\n{\"uuid\":\"2\"}\n", wantStatus: http.StatusOK,
+			want: IngestResult{Accepted: 2}, wantQueued: []string{`{"uuid":"1"}`, `{"uuid":"2"}`}},
+		// 문법 오류 앞의 것은 이미 들어가 있다.
+		{name: "syntax error", body: "{\"uuid\":\"1\"}\n{\"uuid\":\n{\"uuid\":\"3\"}\n", wantStatus: http.StatusBadRequest,
+			want: IngestResult{Accepted: 1, Rejected: 1, Errors: []IngestError{{Index: 1}}}, wantQueued: []string{`{"uuid":"1"}`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := newIngestBase(t)
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/pipelines/orders/items", strings.NewReader(tt.body))
+			ingestHandler(base).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+			var got IngestResult
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("body = %s - %v", rec.Body, err)
+			}
+			for i := range got.Errors {
+				if got.Errors[i].Error == "" {
+					t.Errorf("Errors[%v] has no message", i)
+				}
+				got.Errors[i].Error = ""
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("result = %+v, want %+v", got, tt.want)
+			}
+
+			pipe, err := queue.NewPipelineFromConfigPath(path.Join(base, "orders", "config.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer pipe.Close()
+			var queued []string
+			for _, item := range pipe.Take() {
+				queued = append(queued, string(item.Data))
+				_ = item.Ack()
+			}
+			if !reflect.DeepEqual(queued, tt.wantQueued) {
+				t.Errorf("queued = %q, want %q", queued, tt.wantQueued)
+			}
+		})
+	}
+}
+
+func TestIngestHandler_NotFound(t *testing.T) {
+	base := newIngestBase(t)
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+	}{
+		{name: "no pipeline", method: http.MethodPost, target: "/pipelines/none/items", wantStatus: http.StatusNotFound},
+		{name: "hidden dir", method: http.MethodPost, target: "/pipelines/.orders/items", wantStatus: http.StatusNotFound},
+		{name: "wrong path", method: http.MethodPost, target: "/pipelines/orders/things", wantStatus: http.StatusNotFound},
+		{name: "get", method: http.MethodGet, target: "/pipelines/orders/items", wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(`{"uuid":"1"}`))
+			ingestHandler(base).ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusMethodNotAllowed && rec.Header().Get("Allow") != http.MethodPost {
+				t.Errorf("Allow = %q", rec.Header().Get("Allow"))
+			}
+		})
+	}
+
+	// 잘못된 요청은 큐에 아무것도 넣지 않는다.
+	dirs, _ := os.ReadDir(path.Join(base, "orders"))
+	for _, d := range dirs {
+		if queue.IsQueueFileName(d.Name()) {
+			t.Errorf("queue file %v", d.Name())
+		}
+	}
+}
@@ -5,39 +5,167 @@ import (
 	"encoding/json"
 	"errors"
 	"flag"
+	"fmt"
 	"github.com/sirupsen/logrus"
-	"gopkg.in/go-playground/pool.v3"
 	"lazyboy/queue"
 	"os"
 	"os/signal"
 	"path"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
 type Work struct {
 	Ctx       context.Context
+	RunCtx    context.Context // Overlap 이 CANCEL 일때 다음 실행이 이 실행을 취소한다.
 	Pipe      *queue.Pipeline
 	Req       *queue.Req
 	Res       *queue.Res
+	Item      *queue.Item
 	Index     int
 	UniqueKey interface{}
 }
 
-func runHttpWorkFunc(work *Work) pool.WorkFunc {
-	return func(wu pool.WorkUnit) (interface{}, error) {
-		work.Ctx, _ = context.WithTimeout(context.Background(), time.Second*30)
-		res := work.Req.Run(work.Ctx, work.Pipe)
-		work.Res = res
-		return work, nil // everything ok, send nil, error if not
+func runHttpWork(work *Work) {
+	ctx, cancel := context.WithTimeout(work.RunCtx, time.Second*30)
+	defer cancel()
+	work.Res = work.Req.Run(ctx, work.Pipe)
+}
+
+// finishWork 는 한 건의 결과를 기록하고 그 건만 Ack 한다. Worker 마다 따로 부른다.
+func finishWork(logger *logrus.Entry, outlogger *logrus.Logger, dedup *queue.DedupStore, summary *runSummary, work *Work) {
+	pipe := work.Pipe
+	res := work.Res
+	uniqueKey := work.UniqueKey
+	out := outlogger.WithField("Attempt", work.Item.Attempt)
+	// 재시도로 같은 실행에서 다시 나올 수 있으므로 성공하지 못하면 중복으로 보지 않게 한다.
+	var done bool
+	defer func() {
+		if !done {
+			releaseKey(dedup, uniqueKey)
+		}
+	}()
+
+	// 취소로 실패한 요청은 결과를 남기지 않고 Ack 도 하지 않아서 다음 실행에서 다시 처리된다.
+	if res.Err != "" && work.RunCtx.Err() != nil {
+		logger.Warnf("Canceled %v", uniqueKey)
+		summary.count(&summary.canceled)
+		return
+	}
+
+	if pipe.Retry.ShouldRetry(res, work.Item.Attempt) {
+		retryAt, err := pipe.RetryLater(work.Item)
+		if err == nil {
+			logger.Warnf("Retry %v at %v - %v %v", uniqueKey, retryAt, res.StatusCode, res.Err)
+			out.WithField("UniqueKey", uniqueKey).WithField("RetryAt", retryAt).WithField("StatusCode", res.StatusCode).WithField("error", res.Err).Warnln("retry")
+			// Nack 이 원래 자리를 끝냈으므로 다시 Ack 하지 않는다.
+			summary.count(&summary.retry)
+			return
+		}
+		logger.Warnf("Retry failed - %v", err)
+	}
+
+	if res.Err != "" {
+		logger.Warnf("Http Error: %v", res.Err)
+		out.WithError(errors.New(res.Err)).WithField("UniqueKey", uniqueKey).Errorln("error")
+		recordOutcome(logger, dedup, uniqueKey, queue.DedupOutcomeError)
+		deadLetter(logger, pipe, work.Item, queue.DeadCategoryHttp, errors.New(res.Err), uniqueKey)
+		summary.count(&summary.failed)
+		return
+	}
+
+	resout, err := res.BuildOutput(pipe)
+	if err != nil {
+		logger.Warnf("Building output failed - %v", err)
+		out.WithError(err).WithField("UniqueKey", uniqueKey).Errorln("error")
+		recordOutcome(logger, dedup, uniqueKey, queue.DedupOutcomeError)
+		deadLetter(logger, pipe, work.Item, queue.DeadCategoryOutput, err, uniqueKey)
+		summary.count(&summary.failed)
+		return
+	}
+	// 뒤 파이프라인에 넘기지 못하면 Ack 하지 않아서 다음 실행에서 다시 처리된다.
+	err = pipe.ChainResult(resout)
+	if err != nil {
+		logger.Warnf("Chain failed %v - %v", uniqueKey, err)
+		out.WithError(err).WithField("UniqueKey", uniqueKey).Errorln("error")
+		summary.count(&summary.failed)
+		return
+	}
+	out.WithField("UniqueKey", uniqueKey).WithField("result", resout).Println("ok")
+	// Ack 전에 남겨야 그 사이에 죽어서 다시 나와도 중복으로 걸러진다.
+	recordOutcome(logger, dedup, uniqueKey, queue.DedupOutcomeOk)
+	ack(logger, work.Item)
+	done = true
+	summary.count(&summary.ok)
+
+	logger.Infof("done %v (#%v)", uniqueKey, work.Index+1)
+
+	if work.Ctx.Value("debug") != nil {
+		time.Sleep(time.Second)
+	}
+}
+
+// runSummary 는 한번의 실행에서 결과마다 몇 건인지 센다. Worker 들이 같이 센다.
+type runSummary struct {
+	taken, ok, skipped, duplicate, retry, failed, canceled int64
+}
+
+func (s *runSummary) count(n *int64) {
+	atomic.AddInt64(n, 1)
+}
+
+// String 은 Worker 가 다 끝난 뒤에 불러야 한다.
+func (s *runSummary) String() string {
+	return fmt.Sprintf("Taken %v, Ok %v, Skipped %v, Duplicate %v, Retry %v, Failed %v, Canceled %v",
+		s.taken, s.ok, s.skipped, s.duplicate, s.retry, s.failed, s.canceled)
+}
+
+// ack 은 결과가 output 에 기록된 뒤에 불러야 한다. 그 전에 죽으면 재시작 후 다시 처리된다.
+func ack(logger *logrus.Entry, item *queue.Item) {
+	if err := item.Ack(); err != nil {
+		logger.Warnf("Ack failed %v - %v", item.Source(), err)
+	}
+}
+
+// recordOutcome 은 Dedup 이 켜져 있을 때 UniqueKey 의 결과를 남긴다.
+func recordOutcome(logger *logrus.Entry, dedup *queue.DedupStore, uniqueKey interface{}, outcome queue.DedupOutcome) {
+	if dedup == nil {
+		return
+	}
+	if err := dedup.Record(uniqueKey, outcome, time.Now()); err != nil {
+		logger.Warnf("Dedup record failed %v - %v", uniqueKey, err)
+	}
+}
+
+// releaseKey 는 성공하지 못하고 끝난 key 를 dedup 의 처리 중에서 뺀다.
+func releaseKey(dedup *queue.DedupStore, uniqueKey interface{}) {
+	if dedup != nil {
+		dedup.Release(uniqueKey)
+	}
+}
+
+// deadLetter 는 원본을 _dead 에 남긴 뒤에 큐에서 실패로 끝낸다.
+// 남기지 못하면 Nack 하지 않아서 다음 실행에서 다시 처리된다.
+func deadLetter(logger *logrus.Entry, pipe *queue.Pipeline, item *queue.Item, category queue.DeadCategory, cause error, uniqueKey interface{}) {
+	if err := pipe.DeadLetter(item, category, cause, uniqueKey); err != nil {
+		logger.Warnf("Dead letter failed %v - %v", item.Source(), err)
+		return
+	}
+	// dead letter 에 남았으므로 넘기지 못해도 잃지는 않는다.
+	if err := pipe.ChainError(item, category, cause, uniqueKey); err != nil {
+		logger.Warnf("Chain failed %v - %v", item.Source(), err)
+	}
+	if err := item.Nack(time.Time{}); err != nil {
+		logger.Warnf("Nack failed %v - %v", item.Source(), err)
 	}
 }
-func proc(ctx context.Context, wg *sync.WaitGroup, pipePath string) {
+
+func proc(ctx context.Context, wg *sync.WaitGroup, runs *pipeRuns, pipePath string) {
 
 	logger := logrus.WithContext(ctx)
 
-	wg.Add(1)
 	defer wg.Done()
 
 	logger.Debugf("Begin Proc with %v", pipePath)
@@ -48,6 +176,7 @@ func proc(ctx context.Context, wg *sync.WaitGroup, pipePath string) {
 		logger.Debugf("Can not load config.json in PipePath - %v", err)
 		return
 	}
+	defer pipe.Close()
 
 	outlogger := logrus.New()
 	file, err := os.OpenFile(pipe.OutputAbsPath(), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0666)
@@ -55,6 +184,7 @@ func proc(ctx context.Context, wg *sync.WaitGroup, pipePath string) {
 		logger.Warnf("Cannot Generate output file - %v", err)
 		return
 	}
+	defer file.Close()
 	outlogger.SetFormatter(&logrus.JSONFormatter{})
 	outlogger.SetOutput(file)
 
@@ -65,91 +195,228 @@ func proc(ctx context.Context, wg *sync.WaitGroup, pipePath string) {
 		return
 	}
 
-	workers := pipe.Workers
-	if workers < 1 {
-		logger.Warn("Workers need to be greater than 0")
-		workers = 1
+	// 파일 변경으로 돈 실행은 이전 실행을 취소하거나 건너뛰지 않고 끝나기를 기다린다.
+	_, event := ctx.Value("event").(string)
+	overlap := pipe.Overlap
+	if event {
+		overlap = queue.OverlapQueue
 	}
 
-	// 2. TAKE
-	taken := pipe.Take()
+	runCtx, end, ok := runs.begin(ctx, pipePath, overlap)
+	if !ok {
+		logger.Infof("Skip. Previous run is not finished. Overlap : %v", pipe.Overlap)
+		return
+	}
+	defer end()
 
-	if len(taken) == 0 {
-		logger.Warnf("Empty")
+	// 다른 프로세스가 같은 파이프라인을 돌리고 있으면 잠금파일에서 막힌다.
+	// 다른 프로세스의 실행은 취소시킬 수 없으므로 CANCEL 은 SKIP 처럼 동작한다.
+	lock := queue.NewFileLock(pipe.LockPath())
+	if overlap == queue.OverlapQueue {
+		err = lock.Lock(ctx)
 	} else {
+		var locked bool
+		locked, err = lock.TryLock()
+		if err == nil && !locked {
+			logger.Infof("Skip. Locked by other process : %v", pipe.LockPath())
+			return
+		}
+	}
+	if err != nil {
+		logger.Warnf("Lock failed - %v", err)
+		return
+	}
+	defer lock.Unlock()
+
+	// 여러 프로세스가 queuebase 를 같이 쓸 때는 lease 의 주인만 돌린다.
+	if instance, ok := ctx.Value("instance").(string); ok {
+		lease, err := queue.AcquireLease(pipe.LeasePath(), instance, ctx.Value("leaseTTL").(time.Duration))
+		if err == queue.ErrLeaseHeld {
+			logger.Infof("Skip. Leased by %v until %v", lease.Owner, lease.Expires)
+			return
+		}
+		if err != nil {
+			logger.Warnf("Lease failed - %v", err)
+			return
+		}
+		var cancelRun context.CancelFunc
+		runCtx, cancelRun = context.WithCancel(runCtx)
+		defer cancelRun()
+		go lease.KeepAlive(runCtx, func(err error) {
+			logger.Warnf("Lease lost. Cancel this run - %v", err)
+			cancelRun()
+		})
+	}
 
-		p := pool.NewLimited(uint(workers))
-		defer p.Close()
+	workers := pipe.Workers
+	if workers < 1 {
+		logger.Warn("Workers need to be greater than 0")
+		workers = 1
+	}
 
-		batch := p.Batch()
+	dedup, err := pipe.DedupStore()
+	if err != nil {
+		logger.Warnf("Dedup store failed - %v", err)
+		return
+	}
 
-		// 3. MERGE DATA
-		for i, t := range taken {
-			var takenObj interface{}
-			err := json.Unmarshal(t, &takenObj)
-			if err != nil {
-				logger.Warnf("Invalid line #%v - %v", i+1, err)
-				outlogger.WithError(err).WithField("UniqueKey", nil).Errorln("error")
-				continue
+	// 2. TAKE
+	want := runs.budget(pipePath, pipe.WantToTake())
+	if want <= 0 {
+		logger.Infof("TakePerTick is used up. Wait for the next tick")
+		return
+	}
+	// Worker 가 밀리면 Take 도 멈추므로 TakePerTick 이 커도 들고 있는 Item 은 Workers 개 정도이다.
+	items := pipe.Stream(runCtx, want, workers)
+	works := make(chan *Work)
+	summary := &runSummary{}
+	workersDone := &sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		workersDone.Add(1)
+		go func() {
+			defer workersDone.Done()
+			for work := range works {
+				runHttpWork(work)
+				finishWork(logger, outlogger, dedup, summary, work)
 			}
+		}()
+	}
 
-			uniqueKey, err := pipe.GetUniqueKey(takenObj)
-			if err != nil {
-				logger.Warnf("No uniqueKey '%v' in data - %v", pipe.UniqueKey, err)
-				outlogger.WithError(err).WithField("UniqueKey", nil).WithField("data", takenObj).Errorln("error")
-				continue
-			}
+	// 3. MERGE DATA
+	var count int
+	for t := range items {
+		i := count
+		count++
+		runs.use(pipePath, 1)
+		summary.count(&summary.taken)
+		if runCtx.Err() != nil {
+			summary.count(&summary.canceled)
+			continue
+		}
+		out := outlogger.WithField("Attempt", t.Attempt)
+		if t.Err != nil {
+			logger.Warnf("Invalid row #%v - %v", i+1, t.Err)
+			out.WithError(t.Err).WithField("UniqueKey", nil).Errorln("error")
+			deadLetter(logger, pipe, t, queue.DeadCategoryRow, t.Err, nil)
+			summary.count(&summary.failed)
+			continue
+		}
+		var takenObj interface{}
+		err := json.Unmarshal(t.Data, &takenObj)
+		if err != nil {
+			logger.Warnf("Invalid line #%v - %v", i+1, err)
+			out.WithError(err).WithField("UniqueKey", nil).Errorln("error")
+			deadLetter(logger, pipe, t, queue.DeadCategoryJson, err, nil)
+			summary.count(&summary.failed)
+			continue
+		}
 
-			logger.Infof("proc %v (%v/%v)", uniqueKey, i+1, len(taken))
+		uniqueKey, err := pipe.GetUniqueKey(takenObj)
+		if err != nil {
+			logger.Warnf("No uniqueKey '%v' in data - %v", pipe.UniqueKey, err)
+			out.WithError(err).WithField("UniqueKey", nil).WithField("data", takenObj).Errorln("error")
+			deadLetter(logger, pipe, t, queue.DeadCategoryUniqueKey, err, nil)
+			summary.count(&summary.failed)
+			continue
+		}
 
-			req, err := queue.NewReqFromPipeline(pipe, takenObj)
+		// 걸러낸 Item 은 Schema 에 맞지 않아도 dead letter 로 남기지 않는다.
+		matched, err := pipe.Match(takenObj)
+		if !matched {
+			logger.Infof("Skip by Filter %v", uniqueKey)
+			out = out.WithField("UniqueKey", uniqueKey)
 			if err != nil {
-				logger.Warnf("Building Req failed %v", err)
-				outlogger.WithError(err).WithField("UniqueKey", uniqueKey).Errorln("error")
-				continue
+				out = out.WithError(err)
 			}
-			logger.Debugf("Req : %#v", req)
-
-			batch.Queue(runHttpWorkFunc(&Work{
-				Ctx:       ctx,
-				Pipe:      pipe,
-				Req:       req,
-				Index:     i,
-				UniqueKey: uniqueKey,
-			}))
-
+			out.Println("skipped")
+			ack(logger, t)
+			summary.count(&summary.skipped)
+			continue
 		}
 
-		batch.QueueComplete()
-
-		for workRes := range batch.Results() {
-			work := workRes.Value().(*Work)
-			ctx2 := work.Ctx
-			pipe2 := work.Pipe
-			res := work.Res
-			i := work.Index
-			uniqueKey := work.UniqueKey
-
-			if res.Err != "" {
-				logger.Warnf("Http Error: %v", res.Err)
-				outlogger.WithError(errors.New(res.Err)).WithField("UniqueKey", uniqueKey).Errorln("error")
-				continue
+		err = pipe.Validate(takenObj)
+		if err != nil {
+			logger.Warnf("Invalid item %v - %v", uniqueKey, err)
+			out = out.WithError(err).WithField("UniqueKey", uniqueKey)
+			var invalid *queue.InvalidItemError
+			if errors.As(err, &invalid) {
+				out = out.WithField("Violations", invalid.Violations)
 			}
+			out.Errorln("error")
+			recordOutcome(logger, dedup, uniqueKey, queue.DedupOutcomeError)
+			deadLetter(logger, pipe, t, queue.DeadCategorySchema, err, uniqueKey)
+			summary.count(&summary.failed)
+			continue
+		}
+
+		// 예약 발송은 일찍 보내는 것보다 보내지 않는 것이 낫다.
+		if _, err := pipe.NotBeforeOf(takenObj); err != nil {
+			logger.Warnf("Invalid NotBefore %v - %v", uniqueKey, err)
+			out.WithError(err).WithField("UniqueKey", uniqueKey).Errorln("error")
+			recordOutcome(logger, dedup, uniqueKey, queue.DedupOutcomeError)
+			deadLetter(logger, pipe, t, queue.DeadCategoryNotBefore, err, uniqueKey)
+			summary.count(&summary.failed)
+			continue
+		}
 
-			resout, err := res.BuildOutput(pipe2)
+		// 확인하지 못하면 보내는 쪽을 택한다.
+		if dedup != nil {
+			duplicate, err := dedup.Check(uniqueKey, time.Now())
 			if err != nil {
-				logger.Warnf("Building output failed - %v", err)
-				outlogger.WithError(err).WithField("UniqueKey", uniqueKey).Errorln("error")
+				logger.Warnf("Dedup check failed %v - %v", uniqueKey, err)
+			} else if duplicate {
+				logger.Infof("Skip duplicate %v", uniqueKey)
+				out.WithField("UniqueKey", uniqueKey).Println("duplicate")
+				ack(logger, t)
+				summary.count(&summary.duplicate)
 				continue
 			}
-			outlogger.WithField("UniqueKey", uniqueKey).WithField("result", resout).Println("ok")
-
-			logger.Infof("done %v (%v/%v)", uniqueKey, i+1, len(taken))
+		}
 
-			if ctx2.Value("debug") != nil {
-				time.Sleep(time.Second)
-			}
+		logger.Infof("proc %v (%v/%v)", uniqueKey, i+1, want)
+
+		req, err := queue.NewReqFromPipeline(pipe, takenObj)
+		if err != nil {
+			logger.Warnf("Building Req failed %v", err)
+			out.WithError(err).WithField("UniqueKey", uniqueKey).Errorln("error")
+			recordOutcome(logger, dedup, uniqueKey, queue.DedupOutcomeError)
+			releaseKey(dedup, uniqueKey)
+			deadLetter(logger, pipe, t, queue.DeadCategoryReq, err, uniqueKey)
+			summary.count(&summary.failed)
+			continue
+		}
+		logger.Debugf("Req : %#v", req)
+
+		works <- &Work{
+			Ctx:       ctx,
+			RunCtx:    runCtx,
+			Pipe:      pipe,
+			Req:       req,
+			Item:      t,
+			Index:     i,
+			UniqueKey: uniqueKey,
+		}
+	}
+	close(works)
+	workersDone.Wait()
+	if summary.canceled > 0 {
+		logger.Warnf("Canceled. %v items left for the next run", summary.canceled)
+	}
+	if count == 0 {
+		logger.Warnf("Empty")
+	} else {
+		logger.Infof("Summary. %v", summary)
+	}
 
+	// 4. ARCHIVE
+	// 파일 변경으로 돈 실행에서는 하지 않는다. 열어둔 큐파일을 닫아야 옮길 수 있다.
+	if !event {
+		pipe.Close()
+		archived, removed, err := pipe.ArchiveQueues(time.Now())
+		if err != nil {
+			logger.Warnf("Archive failed - %v", err)
+		} else if archived > 0 || removed > 0 {
+			logger.Infof("Archived %v, Removed %v", archived, removed)
 		}
 	}
 
@@ -157,7 +424,7 @@ func proc(ctx context.Context, wg *sync.WaitGroup, pipePath string) {
 
 }
 
-func tick(ctx context.Context, wg *sync.WaitGroup, pipeBasePath string) {
+func tick(ctx context.Context, wg *sync.WaitGroup, runs *pipeRuns, pipeBasePath string) {
 	logger := logrus.WithContext(ctx)
 	logger.Debug("Tick Begin")
 	dirs, err := os.ReadDir(pipeBasePath)
@@ -168,13 +435,34 @@ func tick(ctx context.Context, wg *sync.WaitGroup, pipeBasePath string) {
 	for _, dir := range dirs {
 		if dir.IsDir() {
 			ctxQueue := context.WithValue(ctx, "queuePath", dir.Name())
-			go proc(ctxQueue, wg, path.Join(pipeBasePath, dir.Name()))
+			wg.Add(1)
+			go proc(ctxQueue, wg, runs, path.Join(pipeBasePath, dir.Name()))
 		}
 	}
 	logger.Debug("Tick End")
 }
 
-func run(ctx context.Context, pipeBasePath string) {
+// releaseLeases 는 종료할 때 이 프로세스의 lease 를 놓아서 다른 프로세스가 바로 넘겨받게 한다.
+func releaseLeases(ctx context.Context, pipeBasePath string) {
+	instance, ok := ctx.Value("instance").(string)
+	if !ok {
+		return
+	}
+	dirs, err := os.ReadDir(pipeBasePath)
+	if err != nil {
+		return
+	}
+	for _, dir := range dirs {
+		if dir.IsDir() {
+			err := queue.ReleaseLease(path.Join(pipeBasePath, dir.Name(), queue.LeaseName), instance)
+			if err != nil {
+				logrus.WithContext(ctx).Warnf("Release lease failed %v - %v", dir.Name(), err)
+			}
+		}
+	}
+}
+
+func run(ctx context.Context, pipeBasePath string, watch bool) {
 	ctxRun := context.WithValue(ctx, "basePath", pipeBasePath)
 	logger := logrus.WithContext(ctxRun)
 	var ticker *time.Ticker
@@ -187,18 +475,35 @@ func run(ctx context.Context, pipeBasePath string) {
 		logrus.SetLevel(logrus.InfoLevel)
 		tickerInterval = time.Minute
 	}
+	// 티커 간격마다 가져갈 건수를 나누므로 티커와 같이 시작한다.
+	runs := newPipeRuns(tickerInterval)
 	ticker = time.NewTicker(tickerInterval)
 	logger.Infof("Ticker Begins interval %v", tickerInterval)
 	//go func() {
 	wg := &sync.WaitGroup{}
 
+	// 파일이 생기면 바로 돌리고, 티커는 놓친 변경을 위해 그대로 둔다.
+	var changed <-chan string
+	if watch {
+		var err error
+		changed, err = watchPipelines(ctx, pipeBasePath)
+		if err != nil {
+			logger.Warnf("Watch failed. Use ticker only - %v", err)
+		}
+	}
+
 SELECT:
 	for {
 		select {
 		case t := <-ticker.C:
 			ctxTick := context.WithValue(ctxRun, "tickAt", t)
 			logger.Infof("Tick at %v", t)
-			tick(ctxTick, wg, pipeBasePath)
+			tick(ctxTick, wg, runs, pipeBasePath)
+		case dir := <-changed:
+			ctxEvent := context.WithValue(context.WithValue(ctxRun, "event", dir), "queuePath", path.Base(dir))
+			logger.Debugf("Changed %v", dir)
+			wg.Add(1)
+			go proc(ctxEvent, wg, runs, dir)
 		case <-ctx.Done():
 			ticker.Stop()
 			break SELECT
@@ -207,6 +512,7 @@ SELECT:
 
 	logger.Info("Waiting processing...")
 	wg.Wait()
+	releaseLeases(ctxRun, pipeBasePath)
 	logger.Info("All Done")
 }
 
@@ -216,14 +522,36 @@ func main() {
 	// TODO Logrotate
 
 	var queueBaseDir string
+	var instance string
+	var leaseTTL time.Duration
+	var watch bool
+	var httpAddr string
 	flag.StringVar(&queueBaseDir, "d", "queuebase", "Queue base directory")
+	flag.StringVar(&instance, "instance", "", "Instance id. Pipelines are leased to one instance when several share the queue base directory")
+	flag.BoolVar(&watch, "watch", true, "Process a pipeline as soon as a queue file is created or appended")
+	flag.DurationVar(&leaseTTL, "lease", time.Minute*3, "Lease expiry. Another instance takes over a pipeline after this")
+	flag.StringVar(&httpAddr, "http", "", "Listen address of the ingest endpoint POST /pipelines/{name}/items (e.g. :8080). Disabled if empty")
 	flag.Parse()
+	if leaseTTL < queue.MinLeaseTTL {
+		fmt.Fprintf(os.Stderr, "-lease must be at least %v\n", queue.MinLeaseTTL)
+		flag.Usage()
+		os.Exit(2)
+	}
 
 	wd, err := os.Getwd()
 	if err != nil {
 		return
 	}
 
+	if flag.NArg() > 0 {
+		err := runCommand(path.Join(wd, queueBaseDir), flag.Args())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	ctx := context.Background()
 
 	debug := os.Getenv("LAZYBOY_DEBUG")
@@ -231,6 +559,11 @@ func main() {
 		ctx = context.WithValue(ctx, "debug", true)
 	}
 
+	if instance != "" {
+		ctx = context.WithValue(ctx, "instance", instance)
+		ctx = context.WithValue(ctx, "leaseTTL", leaseTTL)
+	}
+
 	ctx, cancelFunc := context.WithCancel(ctx)
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
@@ -238,5 +571,8 @@ func main() {
 		<-sigs
 		cancelFunc()
 	}()
-	run(ctx, path.Join(wd, queueBaseDir))
+	if httpAddr != "" {
+		go serveIngest(ctx, httpAddr, path.Join(wd, queueBaseDir))
+	}
+	run(ctx, path.Join(wd, queueBaseDir), watch)
 }
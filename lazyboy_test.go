@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"io"
+	"lazyboy/queue"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestFinishWork_RetryIsNotDuplicate(t *testing.T) {
+	base := t.TempDir()
+	config := `{"OutputPath": "./out.log", "UniqueKey": "$.uuid", "ResTmplName": "res",
+		"Retry": {"MaxAttempts": 2, "BaseDelay": "1ms"}, "Dedup": {"Enabled": true}}`
+	_ = os.WriteFile(path.Join(base, "config.json"), []byte(config), 0644)
+	_ = os.WriteFile(path.Join(base, "res"), []byte(`{"ok": true}`), 0644)
+	_ = os.WriteFile(path.Join(base, "data.jsonl"), []byte(`{"uuid":"1"}`+"\n"), 0644)
+	pipe, err := queue.NewPipelineFromConfigPath(path.Join(base, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pipe.Close()
+	dedup, err := pipe.DedupStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	outlogger := logrus.New()
+	outlogger.SetOutput(io.Discard)
+	summary := &runSummary{}
+
+	// 실패한 것이 같은 실행 안에서 재시도로 다시 나오면 중복이 아니라 다시 보낸다.
+	for attempt, status := range []int{500, 200} {
+		// retry 파일은 초 단위로 올려서 나온다.
+		taken := pipe.TakeN(1)
+		for i := 0; len(taken) == 0 && i < 30; i++ {
+			time.Sleep(time.Millisecond * 100)
+			taken = pipe.TakeN(1)
+		}
+		if len(taken) != 1 || taken[0].Attempt != attempt+1 {
+			t.Fatalf("TakeN() #%v = %v items", attempt+1, len(taken))
+		}
+		duplicate, err := dedup.Check("1", time.Now())
+		if err != nil || duplicate {
+			t.Fatalf("Check() #%v = %v, %v", attempt+1, duplicate, err)
+		}
+		work := &Work{Ctx: context.Background(), RunCtx: context.Background(), Pipe: pipe,
+			Res: &queue.Res{StatusCode: status}, Item: taken[0], UniqueKey: "1"}
+		finishWork(logrus.WithField("Pipename", "test"), outlogger, dedup, summary, work)
+	}
+	if summary.retry != 1 || summary.ok != 1 {
+		t.Errorf("summary = %v", summary)
+	}
+
+	// 성공한 것은 다시 나와도 중복이다.
+	if duplicate, _ := dedup.Check("1", time.Now()); !duplicate {
+		t.Error("Check() after ok = false")
+	}
+}
@@ -0,0 +1,191 @@
+package queue
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path"
+	"time"
+)
+
+// ArchiveDir 는 다 읽은 큐파일을 pos 와 함께 옮겨두는 곳이다.
+const ArchiveDir = "archive"
+
+type ArchivePolicy struct {
+	Grace     Duration // 다 읽은 큐파일이 이만큼 덧붙여지지 않으면 archive/ 로 옮긴다. 0 이면 옮기지 않는다.
+	Gzip      bool     // 옮기면서 gzip 으로 압축한다. 이미 압축된 파일과 .xlsx 는 그대로 옮긴다.
+	Retention Duration // archive/ 로 옮긴 뒤 이만큼 지나면 지운다. 0 이면 지우지 않는다.
+}
+
+// ArchiveQueues 는 ArchivePolicy 대로 큐파일을 치운다. 파이프라인 잠금 안에서 불러야 한다.
+func (pipe *Pipeline) ArchiveQueues(now time.Time) (int, int, error) {
+	return ArchiveFileQueues(pipe.queuePath, pipe.Archive, now)
+}
+
+// ArchiveFileQueues 는 다 읽고 Grace 동안 바뀌지 않은 큐파일을 archive/ 로 옮기고,
+// archive/ 에서 Retention 이 지난 것을 지운다. 옮긴 수와 지운 수를 돌려준다.
+func ArchiveFileQueues(queuePath string, policy ArchivePolicy, now time.Time) (int, int, error) {
+	archived, err := archiveFileQueues(queuePath, policy, now)
+	if err != nil {
+		return archived, 0, err
+	}
+	removed, err := removeArchived(queuePath, policy, now)
+	return archived, removed, err
+}
+
+func archiveFileQueues(queuePath string, policy ArchivePolicy, now time.Time) (int, error) {
+	logger := logrus.WithFields(logrus.Fields{"ctx": "queue/ArchiveFileQueues", "path": queuePath})
+	if policy.Grace <= 0 {
+		return 0, nil
+	}
+	// 옮기는 동안 Producer 가 그 파일에 덧붙이지 않게 한다.
+	unlock, err := lockProducers(queuePath)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	dirs, err := os.ReadDir(queuePath)
+	if err != nil {
+		return 0, err
+	}
+	var archived int
+	for _, d := range dirs {
+		if d.IsDir() || !IsQueueFileName(d.Name()) {
+			continue
+		}
+		info, err := d.Info()
+		if err != nil || now.Sub(info.ModTime()) < time.Duration(policy.Grace) {
+			continue
+		}
+		fq, err := NewFileQueue(queuePath, d.Name())
+		if err != nil {
+			logger.Debug("Skip by Error", err)
+			continue
+		}
+		if fq.Pos.LastError != "" || !fq.IsEOF() {
+			continue
+		}
+		err = fq.archive(policy.Gzip, now)
+		if err != nil {
+			return archived, err
+		}
+		logger.Infof("Archived %v", d.Name())
+		archived++
+	}
+	return archived, nil
+}
+
+// archive 는 큐파일, pos, done 을 archive/ 로 옮긴다.
+// 큐파일을 먼저 옮기므로 중간에 죽어도 pos 없이 남은 큐파일을 처음부터 다시 읽는 일은 없다.
+func (fq *FileQueue) archive(gz bool, now time.Time) error {
+	archivePath := path.Join(fq.QueuePath, ArchiveDir)
+	err := os.MkdirAll(archivePath, 0755)
+	if err != nil {
+		return err
+	}
+	name := fq.FileQueueName
+	if _, err := os.Stat(path.Join(archivePath, name)); err == nil {
+		name = fmt.Sprintf("%v.%v", name, now.Format("20060102T150405"))
+	}
+	src := path.Join(fq.QueuePath, fq.FileQueueName)
+	var moved []string
+	if gz && fq.seekable() {
+		err = gzipFile(src, path.Join(archivePath, name+".gz"))
+		if err == nil {
+			err = os.Remove(src)
+		}
+		moved = append(moved, name+".gz")
+	} else {
+		err = os.Rename(src, path.Join(archivePath, name))
+		moved = append(moved, name)
+	}
+	if err != nil {
+		return err
+	}
+	for _, ext := range []string{".pos", ".done"} {
+		err := os.Rename(src+ext, path.Join(archivePath, name+ext))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		moved = append(moved, name+ext)
+	}
+	// Retention 은 옮긴 때부터 잰다.
+	for _, m := range moved {
+		if err := os.Chtimes(path.Join(archivePath, m), now, now); err != nil {
+			return err
+		}
+	}
+	err = syncDir(archivePath)
+	if err != nil {
+		return err
+	}
+	return syncDir(fq.QueuePath)
+}
+
+// gzipFile 은 임시파일에 다 압축한 뒤 rename 한다.
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmpPath := dst + ".tmp"
+	out, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, dst)
+}
+
+func removeArchived(queuePath string, policy ArchivePolicy, now time.Time) (int, error) {
+	logger := logrus.WithFields(logrus.Fields{"ctx": "queue/ArchiveFileQueues", "path": queuePath})
+	if policy.Retention <= 0 {
+		return 0, nil
+	}
+	archivePath := path.Join(queuePath, ArchiveDir)
+	dirs, err := os.ReadDir(archivePath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var removed int
+	for _, d := range dirs {
+		if d.IsDir() {
+			continue
+		}
+		info, err := d.Info()
+		if err != nil || now.Sub(info.ModTime()) < time.Duration(policy.Retention) {
+			continue
+		}
+		err = os.Remove(path.Join(archivePath, d.Name()))
+		if err != nil {
+			return removed, err
+		}
+		logger.Infof("Removed %v", d.Name())
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,65 @@
+package queue
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestArchiveFileQueues(t *testing.T) {
+	queuePath := path.Join(testBase, "archive_test1")
+	_ = os.MkdirAll(queuePath, 0755)
+	now := time.Now()
+	old := now.Add(-time.Hour * 2)
+	for name, take := range map[string]int{"consumed.jsonl": 2, "fresh.jsonl": 2, "pending.jsonl": 1} {
+		if err := os.WriteFile(path.Join(queuePath, name), []byte("1\n2\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fq, _ := NewFileQueue(queuePath, name)
+		fq.Take(take)
+		if name != "fresh.jsonl" {
+			_ = os.Chtimes(path.Join(queuePath, name), old, old)
+		}
+	}
+	producer, _ := NewProducer(queuePath, ProducerOptions{})
+	defer producer.Close()
+	_ = producer.AppendObject(1)
+	producedAt := now.Add(-time.Hour * 3)
+	_ = os.Chtimes(path.Join(queuePath, producer.FileName()), producedAt, producedAt)
+	fq, _ := NewFileQueue(queuePath, producer.FileName())
+	fq.Take(1)
+
+	policy := ArchivePolicy{Grace: Duration(time.Hour), Gzip: true, Retention: Duration(time.Hour * 24)}
+	archived, removed, err := ArchiveFileQueues(queuePath, policy, now)
+	if err != nil || archived != 2 || removed != 0 {
+		t.Fatalf("ArchiveFileQueues() = %v, %v, %v", archived, removed, err)
+	}
+	for _, name := range []string{"consumed.jsonl", "consumed.jsonl.pos", "produce-0000000001.jsonl"} {
+		if _, err := os.Stat(path.Join(queuePath, name)); !os.IsNotExist(err) {
+			t.Errorf("%v is left", name)
+		}
+	}
+	file, err := os.Open(path.Join(queuePath, ArchiveDir, "consumed.jsonl.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	zr, _ := gzip.NewReader(file)
+	if data, _ := io.ReadAll(zr); string(data) != "1\n2\n" {
+		t.Errorf("archived = %q", data)
+	}
+
+	// 옮겨진 파일에 더 쓰지 않고, 옮겨진 순번도 다시 쓰지 않는다.
+	_ = producer.AppendObject(2)
+	if producer.FileName() != "produce-0000000002.jsonl" {
+		t.Errorf("FileName() = %v", producer.FileName())
+	}
+
+	archived, removed, err = ArchiveFileQueues(queuePath, policy, now.Add(time.Hour*25))
+	if err != nil || removed != 4 {
+		t.Errorf("ArchiveFileQueues() = %v, %v, %v", archived, removed, err)
+	}
+}
@@ -0,0 +1,85 @@
+package queue
+
+import (
+	"errors"
+	"time"
+)
+
+type BackendType string
+
+const BackendTypeFile = BackendType("FILE")
+const BackendTypeSqlite = BackendType("SQLITE")
+const BackendTypeInbox = BackendType("INBOX")
+
+// QueueBackend 는 파이프라인의 Item 을 보관한다.
+// Take 로 예약된 Item 은 Ack 나 Nack 이 되기 전까지 다음 Take 에 나오지 않고,
+// 그 전에 프로세스가 죽으면 다음 실행에서 다시 나온다.
+type QueueBackend interface {
+	Offer(data []byte) error
+	Take(n int) ([]*Item, error)
+	Ack(item *Item) error
+	// Nack 은 retryAt 이후에 Attempt 를 하나 올려서 다시 나오게 한다. retryAt 이 zero 면 실패로 끝낸다.
+	Nack(item *Item, retryAt time.Time) error
+	// Defer 는 Attempt 를 올리지 않고 notBefore 이후에 다시 나오게 한다. 그 사이에 뒤의 Item 은 막히지 않는다.
+	Defer(item *Item, notBefore time.Time) error
+	Stats() (QueueStats, error)
+	Close() error
+}
+
+type QueueStats struct {
+	Pending  int64
+	InFlight int64
+	Done     int64
+	Failed   int64
+}
+
+var ErrUnknownBackend = errors.New("unknown backend")
+
+// Backend 는 config 의 Backend 에 맞는 QueueBackend 를 처음 부를 때 연다.
+func (pipe *Pipeline) Backend() (QueueBackend, error) {
+	if pipe.backend != nil {
+		return pipe.backend, nil
+	}
+	var err error
+	switch pipe.BackendType {
+	case "", BackendTypeFile:
+		files := NewFileBackend(pipe.queuePath, pipe.WaitForDone)
+		files.Csv, files.Xlsx, files.Priority = pipe.Csv, pipe.Xlsx, pipe.Priority
+		pipe.backend = files
+	case BackendTypeSqlite:
+		var sqlite *SqliteBackend
+		sqlite, err = NewSqliteBackend(pipe.queuePath, pipe.WaitForDone)
+		if err != nil {
+			return nil, err
+		}
+		sqlite.files.Csv, sqlite.files.Xlsx = pipe.Csv, pipe.Xlsx
+		pipe.backend = sqlite
+	case BackendTypeInbox:
+		var inbox *InboxBackend
+		inbox, err = NewInboxBackend(pipe.queuePath)
+		if err != nil {
+			return nil, err
+		}
+		pipe.backend = inbox
+	default:
+		err = ErrUnknownBackend
+	}
+	return pipe.backend, err
+}
+
+func (pipe *Pipeline) Close() error {
+	if pipe.dedup != nil {
+		pipe.dedup.Close()
+		pipe.dedup = nil
+	}
+	if pipe.chain != nil {
+		pipe.chain.Close()
+		pipe.chain = nil
+	}
+	if pipe.backend == nil {
+		return nil
+	}
+	err := pipe.backend.Close()
+	pipe.backend = nil
+	return err
+}
@@ -0,0 +1,92 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// ChainPolicy 는 결과를 다른 파이프라인의 큐에 넘긴다.
+type ChainPolicy struct {
+	Pipeline string // 넘길 파이프라인. 같은 queuebase 안의 디렉토리 이름이다.
+	Errors   bool   // true 면 dead letter 로 끝난 것도 DeadLetter 형식으로 넘긴다.
+}
+
+// checkChain 은 Chain 을 따라가면서 파이프라인이 있는지, 다시 돌아오지 않는지 확인한다.
+func (pipe *Pipeline) checkChain() error {
+	if pipe.Chain.Pipeline == "" {
+		return nil
+	}
+	basePath := path.Dir(pipe.queuePath)
+	route := []string{path.Base(pipe.queuePath)}
+	next := pipe.Chain.Pipeline
+	for next != "" {
+		if strings.ContainsAny(next, `/\`) || next == "." || next == ".." {
+			return fmt.Errorf("invalid Chain.Pipeline %v", next)
+		}
+		for _, name := range route {
+			if name == next {
+				return fmt.Errorf("Chain makes a cycle %v -> %v", strings.Join(route, " -> "), next)
+			}
+		}
+		route = append(route, next)
+		b, err := os.ReadFile(path.Join(basePath, next, "config.json"))
+		if err != nil {
+			return fmt.Errorf("Chain.Pipeline %v - %w", next, err)
+		}
+		var downstream struct{ Chain ChainPolicy }
+		err = json.Unmarshal(b, &downstream)
+		if err != nil {
+			return fmt.Errorf("Chain.Pipeline %v - %w", next, err)
+		}
+		next = downstream.Chain.Pipeline
+	}
+	return nil
+}
+
+// chainBackend 는 Chain 이 있으면 처음 부를 때 뒤 파이프라인을 읽어서 그 Backend 를 연다.
+// 뒤 파이프라인의 Backend 가 무엇이든 그 Offer 로 넣으므로 다른 생산자와 같이 보관된다.
+func (pipe *Pipeline) chainBackend() (QueueBackend, error) {
+	pipe.chainMu.Lock()
+	defer pipe.chainMu.Unlock()
+	if pipe.chain == nil {
+		downstream, err := NewPipelineFromConfigPath(path.Join(path.Dir(pipe.queuePath), pipe.Chain.Pipeline, "config.json"))
+		if err != nil {
+			return nil, fmt.Errorf("Chain.Pipeline %v - %w", pipe.Chain.Pipeline, err)
+		}
+		pipe.chain = downstream
+	}
+	return pipe.chain.Backend()
+}
+
+// chainObject 는 v 를 한 줄의 JSON 으로 뒤 파이프라인에 넣는다.
+func (pipe *Pipeline) chainObject(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	backend, err := pipe.chainBackend()
+	if err != nil {
+		return err
+	}
+	return backend.Offer(data)
+}
+
+// ChainResult 는 BuildOutput 의 결과를 뒤 파이프라인에 한 건으로 넘긴다. Chain 이 없으면 아무것도 하지 않는다.
+// Ack 전에 불러야 그 사이에 죽어도 잃지 않는다. 대신 다시 처리되면 두번 넘어갈 수 있다.
+func (pipe *Pipeline) ChainResult(result interface{}) error {
+	if pipe.Chain.Pipeline == "" {
+		return nil
+	}
+	return pipe.chainObject(result)
+}
+
+// ChainError 는 Chain.Errors 이면 dead letter 와 같은 내용을 뒤 파이프라인에 넘긴다.
+func (pipe *Pipeline) ChainError(item *Item, category DeadCategory, cause error, uniqueKey interface{}) error {
+	if pipe.Chain.Pipeline == "" || !pipe.Chain.Errors {
+		return nil
+	}
+	return pipe.chainObject(newDeadLetter(item, category, cause, uniqueKey))
+}
@@ -0,0 +1,111 @@
+package queue
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestPipeline_checkChain(t *testing.T) {
+	basePath := path.Join(testBase, "chain_test1")
+	write := func(name, chain string) {
+		_ = os.MkdirAll(path.Join(basePath, name), 0755)
+		config := `{"OutputPath":"out.log","UniqueKey":"$.id","Chain":{"Pipeline":"` + chain + `","Errors":true}}`
+		if err := os.WriteFile(path.Join(basePath, name, "config.json"), []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a", "b")
+	write("b", "c")
+	write("c", "")
+	write("self", "self")
+	write("x", "y")
+	write("y", "x")
+	write("lost", "none")
+
+	tests := []struct {
+		name    string
+		wantErr string
+	}{
+		{name: "a"},
+		{name: "self", wantErr: "cycle self -> self"},
+		{name: "x", wantErr: "cycle x -> y -> x"},
+		{name: "lost", wantErr: "Chain.Pipeline none"},
+	}
+	for _, tt := range tests {
+		pipe, err := NewPipelineFromConfigPath(path.Join(basePath, tt.name, "config.json"))
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%v: %v", tt.name, err)
+			} else {
+				pipe.Close()
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%v: error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	pipe, err := NewPipelineFromConfigPath(path.Join(basePath, "a", "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pipe.ChainResult(map[string]interface{}{"id": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	item := &Item{Data: []byte(`{"id":"2"}`), Attempt: 1}
+	if err := pipe.ChainError(item, DeadCategoryHttp, errors.New("failed"), "2"); err != nil {
+		t.Fatal(err)
+	}
+	pipe.Close()
+
+	// 뒤 파이프라인에서 여느 큐파일처럼 읽힌다.
+	next, err := NewPipelineFromConfigPath(path.Join(basePath, "b", "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer next.Close()
+	taken := next.TakeN(10)
+	if len(taken) != 2 || string(taken[0].Data) != `{"id":"1"}` || !strings.Contains(string(taken[1].Data), `"Category":"HTTP"`) {
+		t.Errorf("TakeN() = %s", itemData(taken, false))
+	}
+	if len(taken) > 0 && !strings.HasPrefix(taken[0].Source(), offerPrefix) {
+		t.Errorf("Source() = %v", taken[0].Source())
+	}
+}
+
+func TestPipeline_ChainInbox(t *testing.T) {
+	basePath := path.Join(testBase, "chain_test2")
+	write := func(name, config string) {
+		_ = os.MkdirAll(path.Join(basePath, name), 0755)
+		if err := os.WriteFile(path.Join(basePath, name, "config.json"), []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("up", `{"OutputPath":"out.log","UniqueKey":"$.id","Chain":{"Pipeline":"down"}}`)
+	write("down", `{"OutputPath":"out.log","UniqueKey":"$.id","Backend":"INBOX"}`)
+
+	pipe, err := NewPipelineFromConfigPath(path.Join(basePath, "up", "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"1", "2"} {
+		if err := pipe.ChainResult(map[string]interface{}{"id": id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pipe.Close()
+
+	// 뒤 파이프라인의 Backend 로 들어가므로 INBOX 에서도 읽힌다.
+	next, err := NewPipelineFromConfigPath(path.Join(basePath, "down", "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer next.Close()
+	if got := itemData(next.TakeN(10), true); len(got) != 2 || string(got[0]) != `{"id":"1"}` || string(got[1]) != `{"id":"2"}` {
+		t.Errorf("TakeN() = %s", got)
+	}
+}
@@ -0,0 +1,224 @@
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const suffixCsv = ".csv"
+const suffixTsv = ".tsv"
+
+type CsvQuoting string
+
+const CsvQuotingStandard = CsvQuoting("STANDARD") // RFC 4180. 따옴표 안의 구분자와 줄바꿈을 값으로 읽는다.
+const CsvQuotingLazy = CsvQuoting("LAZY")         // 필드 중간의 따옴표는 그대로 둔다. 한 줄이 한 레코드이다.
+const CsvQuotingNone = CsvQuoting("NONE")         // 따옴표를 쓰지 않고 구분자로만 나눈다.
+
+type ColumnType string
+
+const ColumnTypeString = ColumnType("STRING")
+const ColumnTypeNumber = ColumnType("NUMBER")
+const ColumnTypeInteger = ColumnType("INTEGER")
+const ColumnTypeBool = ColumnType("BOOL")
+const ColumnTypeJson = ColumnType("JSON")
+
+// CsvOptions 는 .csv/.tsv 큐파일을 읽는 방법이다. 한 행이 JSON 객체 하나가 된다.
+type CsvOptions struct {
+	NoHeader  bool                  // true 면 첫 행도 데이터이다.
+	Columns   []string              // 컬럼 이름. 비어있으면 헤더를 쓰고, 헤더도 없으면 col1, col2 ... 이다.
+	Delimiter string                // 기본값은 .csv 는 "," .tsv 는 탭이다.
+	Quoting   CsvQuoting            // 기본값은 STANDARD 이다.
+	Types     map[string]ColumnType // 컬럼별 타입. 없는 컬럼은 STRING 이다.
+}
+
+func (opts CsvOptions) validate() error {
+	if opts.Delimiter != "" && utf8.RuneCountInString(opts.Delimiter) != 1 {
+		return fmt.Errorf("invalid Csv.Delimiter %q", opts.Delimiter)
+	}
+	switch opts.Quoting {
+	case "", CsvQuotingStandard, CsvQuotingLazy, CsvQuotingNone:
+	default:
+		return fmt.Errorf("unknown Csv.Quoting %s", opts.Quoting)
+	}
+	return validateColumnTypes("Csv", opts.Types)
+}
+
+func validateColumnTypes(field string, types map[string]ColumnType) error {
+	for column, columnType := range types {
+		switch columnType {
+		case ColumnTypeString, ColumnTypeNumber, ColumnTypeInteger, ColumnTypeBool, ColumnTypeJson:
+		default:
+			return fmt.Errorf("unknown %s.Types %s for %s", field, columnType, column)
+		}
+	}
+	return nil
+}
+
+func isCsvFileName(name string) bool {
+	return strings.HasSuffix(name, suffixCsv) || strings.HasSuffix(name, suffixTsv)
+}
+
+// openCsvReader 는 헤더를 먼저 읽고 pos 부터 읽는다. 헤더 행은 첫 Item 의 범위에 포함된다.
+func (fq *FileQueue) openCsvReader(file *os.File, pos int64) (queueReader, error) {
+	r := &csvReader{opts: fq.csv, closed: fq.IsDone(), close: file.Close, comma: ','}
+	if strings.HasSuffix(fq.FileQueueName, suffixTsv) {
+		r.comma = '\t'
+	}
+	if fq.csv.Delimiter != "" {
+		r.comma, _ = utf8.DecodeRuneInString(fq.csv.Delimiter)
+	}
+	r.columns = fq.csv.Columns
+	if !fq.csv.NoHeader {
+		r.rd = bufio.NewReader(file)
+		raw, err := r.readRecord()
+		if err == io.EOF {
+			// 헤더도 아직 다 쓰이지 않았다.
+			r.waiting = true
+			return r, nil
+		}
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		header, err := r.parse(raw)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("invalid csv header - %v", err)
+		}
+		if len(r.columns) == 0 && len(header) > 0 {
+			// 엑셀에서 내보낸 파일은 앞에 BOM 이 붙어있다.
+			header[0] = strings.TrimPrefix(header[0], "\ufeff")
+			r.columns = header
+		}
+		if headerEnd := int64(len(raw)); pos < headerEnd {
+			pos = headerEnd
+		}
+	}
+	_, err := file.Seek(pos, io.SeekStart)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	r.rd = bufio.NewReader(file)
+	r.pos = pos
+	return r, nil
+}
+
+type csvReader struct {
+	rd      *bufio.Reader
+	pos     int64
+	closed  bool // 더 쓰이지 않는 파일이면 줄바꿈 없는 마지막 행도 읽는다.
+	waiting bool // 헤더가 없어서 아무것도 읽지 않는다.
+	close   func() error
+	opts    CsvOptions
+	comma   rune
+	columns []string
+}
+
+func (r *csvReader) Next() ([]byte, int64, error) {
+	if r.waiting {
+		return nil, r.pos, io.EOF
+	}
+	raw, err := r.readRecord()
+	if err != nil {
+		return nil, r.pos, err
+	}
+	r.pos += int64(len(raw))
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return []byte{}, r.pos, nil
+	}
+	data, err := r.toJson(raw)
+	if err != nil {
+		// 변환하지 못한 행은 원본 그대로 돌려준다. dead letter 에 원본과 이유가 남는다.
+		return bytes.TrimRight(raw, "\r\n"), r.pos, &RowError{Err: err}
+	}
+	return data, r.pos, nil
+}
+
+func (r *csvReader) Close() error {
+	return r.close()
+}
+
+// readRecord 는 한 행의 원본을 읽는다. STANDARD 는 따옴표가 닫힐 때까지 다음 줄도 이어서 읽는다.
+func (r *csvReader) readRecord() ([]byte, error) {
+	var record []byte
+	for {
+		line, err := r.rd.ReadBytes('\n')
+		record = append(record, line...)
+		if errors.Is(err, io.EOF) {
+			// 줄바꿈 없는 마지막 행은 아직 쓰고 있는 중일 수 있다. 닫힌 파일이 아니면 다음번에 읽는다.
+			if len(record) == 0 || !r.closed {
+				return nil, io.EOF
+			}
+			return record, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if r.opts.Quoting == CsvQuotingNone || r.opts.Quoting == CsvQuotingLazy || bytes.Count(record, []byte{'"'})%2 == 0 {
+			return record, nil
+		}
+	}
+}
+
+func (r *csvReader) parse(raw []byte) ([]string, error) {
+	line := strings.TrimRight(string(raw), "\r\n")
+	if r.opts.Quoting == CsvQuotingNone {
+		return strings.Split(line, string(r.comma)), nil
+	}
+	cr := csv.NewReader(strings.NewReader(line))
+	cr.Comma = r.comma
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = r.opts.Quoting == CsvQuotingLazy
+	return cr.Read()
+}
+
+func (r *csvReader) toJson(raw []byte) ([]byte, error) {
+	fields, err := r.parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	obj := make(map[string]interface{}, len(fields))
+	for i, field := range fields {
+		column := "col" + strconv.Itoa(i+1)
+		if i < len(r.columns) && r.columns[i] != "" {
+			column = r.columns[i]
+		}
+		obj[column], err = r.opts.Types[column].convert(field)
+		if err != nil {
+			return nil, fmt.Errorf("%s - %v", column, err)
+		}
+	}
+	return json.Marshal(obj)
+}
+
+// convert 는 STRING 이 아닌 빈 값을 null 로 둔다.
+func (columnType ColumnType) convert(value string) (interface{}, error) {
+	if columnType == "" || columnType == ColumnTypeString {
+		return value, nil
+	}
+	if value == "" {
+		return nil, nil
+	}
+	switch columnType {
+	case ColumnTypeNumber:
+		return strconv.ParseFloat(value, 64)
+	case ColumnTypeInteger:
+		return strconv.ParseInt(value, 10, 64)
+	case ColumnTypeBool:
+		return strconv.ParseBool(value)
+	case ColumnTypeJson:
+		var v interface{}
+		err := json.Unmarshal([]byte(value), &v)
+		return v, err
+	}
+	return nil, fmt.Errorf("unknown column type %s", columnType)
+}
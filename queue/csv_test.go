@@ -0,0 +1,110 @@
+package queue
+
+import (
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFileQueue_TakeCsv(t *testing.T) {
+	queuePath := path.Join(testBase, "csv_test1")
+	tests := []struct {
+		name  string
+		csv   CsvOptions
+		takes []int
+		want  [][]string
+	}{
+		{name: "data.csv", csv: CsvOptions{Types: map[string]ColumnType{"age": ColumnTypeInteger, "active": ColumnTypeBool}}, takes: []int{1, 10}, want: [][]string{
+			{`{"active":true,"age":30,"name":"Kim, Minsu","uuid":"1"}`},
+			{`{"active":false,"age":null,"name":"multi\nline \"quoted\"","uuid":"2"}`, `3,Lee,abc,true`},
+		}},
+		{name: "data.tsv", csv: CsvOptions{NoHeader: true, Columns: []string{"uuid"}, Quoting: CsvQuotingNone}, takes: []int{10}, want: [][]string{
+			{`{"col2":"Kim","col3":"30","uuid":"1"}`, `{"col2":"Lee","col3":"\"x\"","uuid":"2"}`},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, n := range tt.takes {
+				// 매번 새로 열어도 헤더를 다시 읽고 Offset 부터 이어서 읽는다.
+				fq, err := NewFileQueue(queuePath, tt.name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				fq.csv = tt.csv
+				var got []string
+				for _, data := range fq.Take(n) {
+					got = append(got, string(data))
+				}
+				if !reflect.DeepEqual(got, tt.want[i]) {
+					t.Errorf("Take() = %q, want %q", got, tt.want[i])
+				}
+			}
+		})
+	}
+
+	// 줄바꿈 없는 마지막 행은 .done 이 생긴 뒤에 읽는다.
+	fq, _ := NewFileQueue(queuePath, "data.csv")
+	if got := fq.Take(10); len(got) != 0 {
+		t.Errorf("Take() = %s", got)
+	}
+	_ = os.WriteFile(path.Join(queuePath, "data.csv.done"), nil, 0644)
+	fq, _ = NewFileQueue(queuePath, "data.csv")
+	fq.csv = CsvOptions{Types: map[string]ColumnType{"age": ColumnTypeNumber}}
+	if got := fq.Take(10); !reflect.DeepEqual(got, [][]byte{[]byte(`{"active":"false","age":41,"name":"Park","uuid":"4"}`)}) {
+		t.Errorf("Take() = %s", got)
+	}
+	if !fq.IsEOF() {
+		t.Errorf("IsEOF() = false")
+	}
+}
+
+func TestCsvOptions_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     CsvOptions
+		wantErr bool
+	}{
+		{name: "default", csv: CsvOptions{}, wantErr: false},
+		{name: "delimiter", csv: CsvOptions{Delimiter: ";"}, wantErr: false},
+		{name: "long delimiter", csv: CsvOptions{Delimiter: "::"}, wantErr: true},
+		{name: "quoting", csv: CsvOptions{Quoting: "DOUBLE"}, wantErr: true},
+		{name: "types", csv: CsvOptions{Types: map[string]ColumnType{"age": "INT"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.csv.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFileQueue_ReserveCsvRowError(t *testing.T) {
+	queuePath := path.Join(testBase, "csv_test2")
+	_ = os.MkdirAll(queuePath, 0755)
+	_ = os.WriteFile(path.Join(queuePath, "rows.csv"), []byte("uuid,age\n1,x\n2,3\n"), 0644)
+	fq, err := NewFileQueue(queuePath, "rows.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fq.csv = CsvOptions{Types: map[string]ColumnType{"age": ColumnTypeInteger}}
+
+	// 바꾸지 못한 행은 원본과 이유를 들고 나오고, 다음 행은 계속 읽는다.
+	items := fq.Reserve(10)
+	if len(items) != 2 {
+		t.Fatalf("Reserve() = %v items", len(items))
+	}
+	var rowErr *RowError
+	if string(items[0].Data) != "1,x" || !errors.As(items[0].Err, &rowErr) || !strings.HasPrefix(items[0].Err.Error(), "age - ") {
+		t.Errorf("items[0] = %s, %v", items[0].Data, items[0].Err)
+	}
+	if string(items[1].Data) != `{"age":3,"uuid":"2"}` || items[1].Err != nil {
+		t.Errorf("items[1] = %s, %v", items[1].Data, items[1].Err)
+	}
+	if fq.Pos.LastError != "" {
+		t.Errorf("LastError = %v", fq.Pos.LastError)
+	}
+}
@@ -0,0 +1,206 @@
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+type DeadCategory string
+
+const DeadCategoryJson = DeadCategory("JSON")
+const DeadCategoryRow = DeadCategory("ROW") // .csv/.tsv/.xlsx 의 행을 Types 대로 바꾸지 못했다.
+const DeadCategoryUniqueKey = DeadCategory("UNIQUEKEY")
+const DeadCategorySchema = DeadCategory("SCHEMA")
+const DeadCategoryNotBefore = DeadCategory("NOTBEFORE")
+const DeadCategoryReq = DeadCategory("REQ")
+const DeadCategoryHttp = DeadCategory("HTTP")
+const DeadCategoryOutput = DeadCategory("OUTPUT")
+
+// DeadLetterDir 는 파이프라인 디렉토리 밑에 있으므로 OfferFileQueue 대상이 아니다.
+const DeadLetterDir = "_dead"
+
+type DeadLetter struct {
+	Data       string
+	Category   DeadCategory
+	Error      string
+	Attempts   int
+	UniqueKey  interface{}       `json:",omitempty"`
+	Violations []SchemaViolation `json:",omitempty"` // SCHEMA 일 때 맞지 않은 곳들
+	Source     string
+	DeadAt     time.Time
+}
+
+func (pipe *Pipeline) DeadLetterPath() string {
+	return path.Join(pipe.queuePath, DeadLetterDir)
+}
+
+// DeadLetter 는 더이상 처리할 수 없는 Item 을 원본 그대로 _dead/<날짜>.jsonl 에 남긴다.
+func (pipe *Pipeline) DeadLetter(item *Item, category DeadCategory, cause error, uniqueKey interface{}) error {
+	letter := newDeadLetter(item, category, cause, uniqueKey)
+	marshaled, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(pipe.DeadLetterPath(), 0755)
+	if err != nil {
+		return err
+	}
+	deadPath := path.Join(pipe.DeadLetterPath(), letter.DeadAt.Format("2006-01-02")+".jsonl")
+	return appendLine(deadPath, marshaled)
+}
+
+func newDeadLetter(item *Item, category DeadCategory, cause error, uniqueKey interface{}) DeadLetter {
+	letter := DeadLetter{
+		Data:      string(item.Data),
+		Category:  category,
+		Error:     cause.Error(),
+		Attempts:  item.Attempt,
+		UniqueKey: uniqueKey,
+		Source:    item.Source(),
+		DeadAt:    time.Now(),
+	}
+	var invalid *InvalidItemError
+	if errors.As(cause, &invalid) {
+		letter.Violations = invalid.Violations
+	}
+	return letter
+}
+
+// requeueSuffix 는 RequeueDeadLetters 가 옮기는 중인 dead letter 파일이다.
+const requeueSuffix = ".requeue"
+
+// RequeueDeadLetters 는 _dead 의 Item 들을 파이프라인의 Backend 로 다시 넣는다.
+// 데몬과 같이 돌 때는 파이프라인 잠금 안에서 불러야 한다.
+// category 가 비어있지 않으면 해당 분류만 옮기고 나머지는 남겨둔다.
+// JSON 이 아닌 것은 다시 넣어도 실패하므로 남겨둔다. _dead 에서 Data 를 고친 뒤에 다시 옮길 수 있다.
+func (pipe *Pipeline) RequeueDeadLetters(category DeadCategory) (int, error) {
+	logger := logrus.WithFields(logrus.Fields{"ctx": "queue/Pipeline.RequeueDeadLetters", "path": pipe.queuePath})
+	deadPath := pipe.DeadLetterPath()
+	dirs, err := os.ReadDir(deadPath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	backend, err := pipe.Backend()
+	if err != nil {
+		return 0, err
+	}
+	// 지난번에 옮기다 멈춘 .requeue 부터 이어서 옮긴다. 그 중 이미 넣은 것은 다시 들어갈 수 있다.
+	var resumed, names []string
+	for _, d := range dirs {
+		if d.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(d.Name(), ".jsonl"+requeueSuffix) {
+			resumed = append(resumed, strings.TrimSuffix(d.Name(), requeueSuffix))
+		} else if strings.HasSuffix(d.Name(), ".jsonl") {
+			names = append(names, d.Name())
+		}
+	}
+	sort.Strings(resumed)
+	sort.Strings(names)
+
+	var requeued, kept int
+	for i, name := range append(resumed, names...) {
+		takenPath := path.Join(deadPath, name+requeueSuffix)
+		if i >= len(resumed) {
+			// 잠금 안이므로 이 파일에 쓰고 있는 proc 은 없다. 남겨둘 것은 원래 이름으로 다시 쓴다.
+			err := os.Rename(path.Join(deadPath, name), takenPath)
+			if err != nil {
+				return requeued, err
+			}
+		}
+		letters, err := readDeadLetters(takenPath)
+		if err != nil {
+			return requeued, err
+		}
+		for i, letter := range letters {
+			var compacted bytes.Buffer
+			if category != "" && letter.Category != category {
+				err = keepDeadLetters(deadPath, name, letters[i:i+1])
+			} else if json.Compact(&compacted, []byte(letter.Data)) != nil {
+				kept++
+				err = keepDeadLetters(deadPath, name, letters[i:i+1])
+			} else {
+				// inbox 의 여러 줄짜리 JSON 도 한 줄로 줄여서 넣는다.
+				err = backend.Offer(compacted.Bytes())
+				if err != nil {
+					// 넣지 못한 것부터는 _dead 에 되돌린다.
+					if keepErr := keepDeadLetters(deadPath, name, letters[i:]); keepErr != nil {
+						return requeued, keepErr
+					}
+					os.Remove(takenPath)
+					return requeued, err
+				}
+				requeued++
+			}
+			if err != nil {
+				return requeued, err
+			}
+		}
+		err = os.Remove(takenPath)
+		if err != nil {
+			return requeued, err
+		}
+	}
+	if kept > 0 {
+		logger.Warnf("Kept %v items that are not JSON", kept)
+	}
+	if requeued > 0 {
+		logger.Infof("Requeued %v items", requeued)
+	}
+	return requeued, nil
+}
+
+// keepDeadLetters 는 옮기지 않을 dead letter 를 _dead/<name> 에 되돌린다.
+func keepDeadLetters(deadPath, name string, letters []DeadLetter) error {
+	for _, letter := range letters {
+		marshaled, err := json.Marshal(letter)
+		if err != nil {
+			return err
+		}
+		err = appendLine(path.Join(deadPath, name), marshaled)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readDeadLetters(deadPath string) ([]DeadLetter, error) {
+	file, err := os.Open(deadPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var letters []DeadLetter
+	rd := bufio.NewReader(file)
+	for {
+		line, err := rd.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			var letter DeadLetter
+			if err := json.Unmarshal(line, &letter); err != nil {
+				return nil, err
+			}
+			letters = append(letters, letter)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return letters, nil
+}
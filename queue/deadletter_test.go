@@ -0,0 +1,117 @@
+package queue
+
+import (
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequeueDeadLetters(t *testing.T) {
+	queuePath := path.Join(testBase, "deadletter_test1")
+	pipe := newQueue(path.Join(queuePath, "_config.json"))
+
+	taken := pipe.Take()
+	if len(taken) != 3 {
+		t.Fatalf("Take() = %v items", len(taken))
+	}
+	categories := []DeadCategory{DeadCategoryHttp, DeadCategoryJson, DeadCategoryHttp}
+	for i, item := range taken {
+		if err := pipe.DeadLetter(item, categories[i], errors.New("failed"), nil); err != nil {
+			t.Fatal(err)
+		}
+		_ = item.Ack()
+	}
+
+	n, err := pipe.RequeueDeadLetters(DeadCategoryHttp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("RequeueDeadLetters() = %v, want 2", n)
+	}
+
+	// 옮긴 것은 원본 그대로 다시 큐에 들어간다.
+	requeued := newQueue(path.Join(queuePath, "_config.json")).Take()
+	if got := itemData(requeued, true); !reflect.DeepEqual(got, [][]byte{[]byte(`{"uuid":"1"}`), []byte(`{"uuid":"3"}`)}) {
+		t.Errorf("Take() after requeue = %s", got)
+	}
+	if !strings.HasPrefix(requeued[0].Source(), offerPrefix) {
+		t.Errorf("Source() = %v", requeued[0].Source())
+	}
+
+	// 분류가 다른 것은 남아있다.
+	dirs, _ := os.ReadDir(pipe.DeadLetterPath())
+	if len(dirs) != 1 {
+		t.Fatalf("dead files = %v", len(dirs))
+	}
+	letters, err := readDeadLetters(path.Join(pipe.DeadLetterPath(), dirs[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 || letters[0].Data != "not json" || letters[0].Category != DeadCategoryJson {
+		t.Errorf("remaining letters = %#v", letters)
+	}
+}
+
+func TestRequeueDeadLetters_Inbox(t *testing.T) {
+	queuePath := path.Join(testBase, "deadletter_test2")
+	pipe := newQueue(path.Join(queuePath, "_config.json"))
+	defer pipe.Close()
+
+	taken := pipe.Take()
+	if len(taken) != 2 {
+		t.Fatalf("Take() = %v items", len(taken))
+	}
+	for _, item := range taken {
+		if err := pipe.DeadLetter(item, DeadCategoryHttp, errors.New("failed"), nil); err != nil {
+			t.Fatal(err)
+		}
+		_ = item.Nack(time.Time{})
+	}
+
+	// inbox/ 로 되돌아가고, 여러 줄짜리 JSON 은 한 줄로 줄어든다.
+	n, err := pipe.RequeueDeadLetters("")
+	if err != nil || n != 2 {
+		t.Fatalf("RequeueDeadLetters() = %v, %v", n, err)
+	}
+	requeued := itemData(pipe.Take(), true)
+	if !reflect.DeepEqual(requeued, [][]byte{[]byte(`{"uuid":"1"}`), []byte(`{"uuid":"2","tags":["a","b"]}`)}) {
+		t.Errorf("Take() after requeue = %s", requeued)
+	}
+	if dirs, _ := os.ReadDir(pipe.DeadLetterPath()); len(dirs) != 0 {
+		t.Errorf("dead files = %v", len(dirs))
+	}
+}
+
+func TestRequeueDeadLetters_Resume(t *testing.T) {
+	queuePath := path.Join(testBase, "deadletter_test3")
+	deadPath := path.Join(queuePath, DeadLetterDir)
+	_ = os.MkdirAll(deadPath, 0755)
+	_ = os.WriteFile(path.Join(queuePath, "_config.json"), []byte(`{"OutputPath":"out.log","UniqueKey":"$.uuid"}`), 0644)
+	// 지난번에 옮기다 멈춘 파일과 그 뒤에 새로 쌓인 파일이 같이 있다.
+	_ = os.WriteFile(path.Join(deadPath, "2026-01-01.jsonl.requeue"), []byte(`{"Data":"{\"uuid\":\"1\"}","Category":"HTTP"}`+"\n"+`{"Data":"{\"uuid\":\"2\"}","Category":"REQ"}`+"\n"), 0644)
+	_ = os.WriteFile(path.Join(deadPath, "2026-01-01.jsonl"), []byte(`{"Data":"{\"uuid\":\"3\"}","Category":"HTTP"}`+"\n"), 0644)
+	pipe := newQueue(path.Join(queuePath, "_config.json"))
+	defer pipe.Close()
+
+	n, err := pipe.RequeueDeadLetters(DeadCategoryHttp)
+	if err != nil || n != 2 {
+		t.Fatalf("RequeueDeadLetters() = %v, %v", n, err)
+	}
+	if got := itemData(pipe.TakeN(10), true); !reflect.DeepEqual(got, [][]byte{[]byte(`{"uuid":"1"}`), []byte(`{"uuid":"3"}`)}) {
+		t.Errorf("Take() after requeue = %s", got)
+	}
+	// 분류가 다른 것은 원래 이름으로 남는다.
+	dirs, _ := os.ReadDir(deadPath)
+	if len(dirs) != 1 || dirs[0].Name() != "2026-01-01.jsonl" {
+		t.Fatalf("dead files = %v", dirs)
+	}
+	letters, _ := readDeadLetters(path.Join(deadPath, dirs[0].Name()))
+	if len(letters) != 1 || letters[0].Category != DeadCategoryReq {
+		t.Errorf("remaining letters = %#v", letters)
+	}
+}
@@ -0,0 +1,152 @@
+package queue
+
+import (
+	"database/sql"
+	"encoding/json"
+	"path"
+	"sync"
+	"time"
+)
+
+// DedupStoreName 은 파이프라인 디렉토리 안에서 처리한 UniqueKey 를 남기는 SQLite 파일이다.
+const DedupStoreName = "_dedup.db"
+
+type DedupOutcome string
+
+const DedupOutcomeOk = DedupOutcome("OK")
+const DedupOutcomeError = DedupOutcome("ERROR")
+
+type DedupPolicy struct {
+	Enabled bool
+	Window  Duration // 이 안에 성공한 UniqueKey 는 다시 보내지 않는다. 0 이면 기한이 없다.
+}
+
+// DedupStore 는 UniqueKey 마다 마지막 결과와 시각을 남긴다.
+type DedupStore struct {
+	Window time.Duration
+	db     *sql.DB
+	seen   map[string]bool // Check 를 지나 처리 중인 key. 끝나기 전에 다시 나온 같은 key 를 잡는다.
+	mu     sync.Mutex      // seen 은 Worker 에서도 Release 한다.
+}
+
+func OpenDedupStore(queuePath string, window time.Duration) (*DedupStore, error) {
+	db, err := sql.Open("sqlite", path.Join(queuePath, DedupStoreName))
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	for _, stmt := range []string{
+		`PRAGMA journal_mode=WAL`,
+		`PRAGMA busy_timeout=5000`,
+		`CREATE TABLE IF NOT EXISTS keys (
+			key TEXT PRIMARY KEY,
+			outcome TEXT NOT NULL,
+			updated_at INTEGER NOT NULL
+		)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	store := &DedupStore{Window: window, db: db, seen: map[string]bool{}}
+	// 기한이 지난 것은 더 볼 일이 없다.
+	if window > 0 {
+		_, err = db.Exec(`DELETE FROM keys WHERE updated_at < ?`, time.Now().Add(-window).UnixMilli())
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// Check 는 key 가 Window 안에 성공했거나 Check 한 뒤 아직 Release 하지 않은 것이면 중복으로 본다.
+func (store *DedupStore) Check(key interface{}, now time.Time) (bool, error) {
+	k, err := dedupKey(key)
+	if err != nil {
+		return false, err
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.seen[k] {
+		return true, nil
+	}
+	succeeded, err := store.Succeeded(key, now)
+	if err != nil {
+		return false, err
+	}
+	if !succeeded {
+		store.seen[k] = true
+	}
+	return succeeded, nil
+}
+
+// Release 는 성공하지 못한 key 를 처리 중에서 빼서, 재시도나 같은 key 의 다른 건이 다시 나오면 보내게 한다.
+func (store *DedupStore) Release(key interface{}) {
+	k, err := dedupKey(key)
+	if err != nil {
+		return
+	}
+	store.mu.Lock()
+	delete(store.seen, k)
+	store.mu.Unlock()
+}
+
+// Succeeded 는 key 가 Window 안에 성공한 적이 있는지 본다.
+func (store *DedupStore) Succeeded(key interface{}, now time.Time) (bool, error) {
+	k, err := dedupKey(key)
+	if err != nil {
+		return false, err
+	}
+	var outcome DedupOutcome
+	var updatedAt int64
+	err = store.db.QueryRow(`SELECT outcome, updated_at FROM keys WHERE key = ?`, k).Scan(&outcome, &updatedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if outcome != DedupOutcomeOk {
+		return false, nil
+	}
+	return store.Window <= 0 || now.Sub(time.UnixMilli(updatedAt)) < store.Window, nil
+}
+
+func (store *DedupStore) Record(key interface{}, outcome DedupOutcome, now time.Time) error {
+	k, err := dedupKey(key)
+	if err != nil {
+		return err
+	}
+	_, err = store.db.Exec(`INSERT INTO keys (key, outcome, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET outcome = excluded.outcome, updated_at = excluded.updated_at`,
+		k, outcome, now.UnixMilli())
+	return err
+}
+
+func (store *DedupStore) Close() error {
+	return store.db.Close()
+}
+
+// dedupKey 는 "1" 과 1 이 다른 키가 되도록 JSON 으로 남긴다.
+func dedupKey(key interface{}) (string, error) {
+	b, err := json.Marshal(key)
+	return string(b), err
+}
+
+// DedupStore 는 Dedup 이 켜져 있으면 처음 부를 때 연다. 꺼져 있으면 nil 이다.
+func (pipe *Pipeline) DedupStore() (*DedupStore, error) {
+	if !pipe.Dedup.Enabled {
+		return nil, nil
+	}
+	if pipe.dedup != nil {
+		return pipe.dedup, nil
+	}
+	store, err := OpenDedupStore(pipe.queuePath, time.Duration(pipe.Dedup.Window))
+	if err != nil {
+		return nil, err
+	}
+	pipe.dedup = store
+	return store, nil
+}
@@ -0,0 +1,56 @@
+package queue
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestDedupStore(t *testing.T) {
+	queuePath := path.Join(testBase, "dedup_test1")
+	_ = os.MkdirAll(queuePath, 0755)
+	now := time.Now()
+
+	store, err := OpenDedupStore(queuePath, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = store.Record("ok", DedupOutcomeOk, now)
+	_ = store.Record("old", DedupOutcomeOk, now.Add(-time.Hour*2))
+	_ = store.Record("failed", DedupOutcomeError, now)
+	_ = store.Record(1, DedupOutcomeOk, now)
+	store.Close()
+
+	store, err = OpenDedupStore(queuePath, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	tests := []struct {
+		key  interface{}
+		want bool
+	}{
+		{key: "ok", want: true},
+		{key: "old", want: false},
+		{key: "failed", want: false},
+		{key: float64(1), want: true},
+		{key: "1", want: false},
+		{key: "new", want: false},
+		// 같은 Take 안에서 두번째로 나온 것
+		{key: "new", want: true},
+		{key: "failed", want: true},
+	}
+	for _, tt := range tests {
+		got, err := store.Check(tt.key, now)
+		if err != nil || got != tt.want {
+			t.Errorf("Check(%#v) = %v, %v, want %v", tt.key, got, err, tt.want)
+		}
+	}
+
+	// 성공하지 못하고 끝난 것은 다시 나오면 보낸다.
+	store.Release("new")
+	if got, err := store.Check("new", now); err != nil || got {
+		t.Errorf("Check() after Release = %v, %v", got, err)
+	}
+}
@@ -0,0 +1,298 @@
+package queue
+
+import (
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileBackend 는 파이프라인 디렉토리의 .jsonl 파일들을 큐로 쓴다. 기본 백엔드이다.
+type FileBackend struct {
+	QueuePath   string
+	WaitForDone bool                  // true 면 <이름>.done 이 생긴 큐파일만 읽는다.
+	Csv         CsvOptions            // .csv/.tsv 큐파일을 읽는 방법
+	Xlsx        XlsxOptions           // .xlsx 큐파일을 읽는 방법
+	Priority    PriorityPolicy        // 큐파일 이름으로 나눈 lane 을 읽는 순서
+	reserved    map[string]*FileQueue // 이번 실행에서 Reserve 중인 큐파일들
+	listed      []*FileQueue          // 지난번 Take 에서 찾은 큐파일들
+	producer    *Producer
+	swept       bool // 이번 실행에서 quarantineStuck 을 했는지
+	mu          sync.Mutex
+}
+
+func NewFileBackend(queuePath string, waitForDone bool) *FileBackend {
+	return &FileBackend{QueuePath: queuePath, WaitForDone: waitForDone, reserved: map[string]*FileQueue{}}
+}
+
+// offerPrefix 는 Offer 가 덧붙이는 큐파일이다.
+const offerPrefix = "offer-"
+
+// offerMaxSize 를 넘으면 Offer 는 다음 offer-<순번>.jsonl 로 넘어간다.
+const offerMaxSize = 64 << 20
+
+// Offer 는 Producer 로 offer-<순번>.jsonl 뒤에 한 줄로 붙인다.
+func (backend *FileBackend) Offer(data []byte) error {
+	backend.mu.Lock()
+	if backend.producer == nil {
+		producer, err := NewProducer(backend.QueuePath, ProducerOptions{Prefix: offerPrefix, MaxSize: offerMaxSize, Sync: true})
+		if err != nil {
+			backend.mu.Unlock()
+			return err
+		}
+		backend.producer = producer
+	}
+	producer := backend.producer
+	backend.mu.Unlock()
+	return producer.Append(data)
+}
+
+func (backend *FileBackend) Take(n int) ([]*Item, error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	var gTaken = make([]*Item, 0)
+	if n <= 0 {
+		return gTaken, nil
+	}
+	if !backend.swept {
+		err := backend.quarantineStuck()
+		if err != nil {
+			return gTaken, err
+		}
+		backend.swept = true
+	}
+	// 큐파일마다 pos 를 확인해야 하므로 목록은 Take 할 때마다 찾지 않고,
+	// 지난번에 찾은 큐파일을 다 읽었을 때만 그 사이에 생긴 큐파일을 다시 찾는다.
+	gTaken, err := backend.takeFrom(backend.listed, n)
+	if err != nil || len(gTaken) >= n {
+		return gTaken, err
+	}
+	queues, err := backend.queues()
+	if err != nil {
+		return gTaken, err
+	}
+	taken, err := backend.takeFrom(queues, n-len(gTaken))
+	return append(gTaken, taken...), err
+}
+
+func (backend *FileBackend) takeFrom(queues []*FileQueue, n int) ([]*Item, error) {
+	var gTaken = make([]*Item, 0)
+	var err error
+	if len(queues) == 0 {
+		return gTaken, nil
+	}
+	if len(backend.Priority.Lanes) > 0 {
+		gTaken, err = backend.takeLanes(queues, n)
+	} else {
+		for _, queue := range queues {
+			gTaken = append(gTaken, queue.Reserve(n-len(gTaken))...)
+			if len(gTaken) >= n {
+				break
+			}
+		}
+	}
+	for _, item := range gTaken {
+		item.backend = backend
+	}
+	return gTaken, err
+}
+
+// queues 는 읽을 것이 남은 큐파일들을 찾아서 다음 Take 에서도 쓰도록 남긴다.
+// 같은 파일을 다시 열면 예약 위치를 잃으므로 이미 예약중인 것은 그것을 이어서 쓴다.
+func (backend *FileBackend) queues() ([]*FileQueue, error) {
+	listed, err := ListFileQueues(backend.QueuePath)
+	if err != nil {
+		return nil, err
+	}
+	queues := make([]*FileQueue, 0, len(listed))
+	for _, queue := range listed {
+		if backend.WaitForDone && !ownQueueFile(queue.FileQueueName) && !queue.IsDone() {
+			continue
+		}
+		if reserved, ok := backend.reserved[queue.FileQueueName]; ok {
+			queue = reserved
+		} else {
+			queue.csv, queue.xlsx = backend.Csv, backend.Xlsx
+			backend.reserved[queue.FileQueueName] = queue
+		}
+		queues = append(queues, queue)
+	}
+	backend.listed = queues
+	return queues, nil
+}
+
+// ownQueueFile 은 lazyboy 가 한 줄씩 온전하게 써넣는 큐파일이다. .done 을 기다리지 않는다.
+func ownQueueFile(name string) bool {
+	return isRetryQueue(name) || strings.HasPrefix(name, offerPrefix)
+}
+
+func (backend *FileBackend) Ack(item *Item) error {
+	return item.queue.ack(item)
+}
+
+// Nack 은 Item 을 retry-<시각>.jsonl 에 옮겨적고 원래 자리는 Ack 한다.
+// 파일이름의 시각이 지나기 전까지는 OfferFileQueue 가 이 파일을 내주지 않는다.
+func (backend *FileBackend) Nack(item *Item, retryAt time.Time) error {
+	if retryAt.IsZero() {
+		return item.queue.ack(item)
+	}
+	return backend.requeue(item, item.Attempt+1, retryAt.UTC().Truncate(time.Second).Add(time.Second))
+}
+
+// Defer 는 retry 파일을 분 단위로 모아서 파일 수가 늘어나지 않게 한다. 그만큼 늦게 나올 수 있다.
+func (backend *FileBackend) Defer(item *Item, notBefore time.Time) error {
+	at := notBefore.UTC().Truncate(time.Minute)
+	if at.Before(notBefore) {
+		at = at.Add(time.Minute)
+	}
+	return backend.requeue(item, item.Attempt, at)
+}
+
+func (backend *FileBackend) requeue(item *Item, attempt int, at time.Time) error {
+	marshaled, err := json.Marshal(retryEnvelope{Attempt: attempt, Data: string(item.Data)})
+	if err != nil {
+		return err
+	}
+	retryPath := path.Join(backend.QueuePath, retryPrefix+at.Format(retryTimeFormat)+".jsonl")
+	err = appendLine(retryPath, marshaled)
+	if err != nil {
+		return err
+	}
+	return item.queue.ack(item)
+}
+
+// Stats 는 큐파일들의 줄 수를 센다. Failed 는 _dead 에 남은 건수이다.
+func (backend *FileBackend) Stats() (QueueStats, error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	var stats QueueStats
+	dirs, err := os.ReadDir(backend.QueuePath)
+	if err != nil {
+		return stats, err
+	}
+	for _, d := range dirs {
+		if d.IsDir() || !IsQueueFileName(d.Name()) {
+			continue
+		}
+		queue, ok := backend.reserved[d.Name()]
+		if !ok {
+			queue, err = NewFileQueue(backend.QueuePath, d.Name())
+			if err != nil {
+				logrus.WithFields(logrus.Fields{"ctx": "queue/FileBackend.Stats", "path": backend.QueuePath}).Debug("Skip by Error", err)
+				continue
+			}
+			queue.csv, queue.xlsx = backend.Csv, backend.Xlsx
+		}
+		done, rest, err := countItems(queue)
+		if err != nil {
+			return stats, err
+		}
+		inFlight := int64(queue.inFlight())
+		stats.Done += done
+		stats.InFlight += inFlight
+		stats.Pending += rest - inFlight
+	}
+
+	deadDirs, err := os.ReadDir(path.Join(backend.QueuePath, DeadLetterDir))
+	if err != nil && !os.IsNotExist(err) {
+		return stats, err
+	}
+	for _, d := range deadDirs {
+		if d.IsDir() {
+			continue
+		}
+		_, failed, err := countLines(path.Join(backend.QueuePath, DeadLetterDir, d.Name()), 0)
+		if err != nil {
+			return stats, err
+		}
+		stats.Failed += failed
+	}
+	return stats, nil
+}
+
+func (backend *FileBackend) Close() error {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	for _, queue := range backend.reserved {
+		queue.Close()
+	}
+	if backend.producer != nil {
+		return backend.producer.Close()
+	}
+	return nil
+}
+
+// countItems 는 Pos.Offset 앞과 뒤의 비어있지 않은 건수를 센다. 압축파일도 풀어서 센다.
+func countItems(queue *FileQueue) (int64, int64, error) {
+	rd, err := queue.openReader(0)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rd.Close()
+	var before, after int64
+	for {
+		data, next, err := rd.Next()
+		if err == io.EOF {
+			return before, after, nil
+		}
+		err = ignoreRowError(err)
+		if err != nil {
+			return before, after, err
+		}
+		if len(data) == 0 {
+			continue
+		}
+		if next <= queue.Pos.Offset {
+			before++
+		} else {
+			after++
+		}
+	}
+}
+
+// countLines 는 offset 앞과 뒤의 비어있지 않은 줄 수를 센다.
+func countLines(filePath string, offset int64) (int64, int64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+	var before, after int64
+	var pos int64
+	var lineLen int
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := file.Read(buf)
+		for _, b := range buf[:n] {
+			pos++
+			if b == '\n' || b == '\r' {
+				if lineLen > 0 {
+					if pos <= offset {
+						before++
+					} else {
+						after++
+					}
+				}
+				lineLen = 0
+				continue
+			}
+			lineLen++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if lineLen > 0 {
+		after++
+	}
+	return before, after, nil
+}
@@ -0,0 +1,46 @@
+package queue
+
+import (
+	"errors"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileBackend(t *testing.T) {
+	queuePath := path.Join(testBase, "file_backend_test1")
+	backend := NewFileBackend(queuePath, false)
+
+	taken, err := backend.Take(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := itemData(taken, false); !reflect.DeepEqual(got, [][]byte{[]byte(`{"uuid":"1"}`), []byte(`{"uuid":"2"}`)}) {
+		t.Errorf("Take() = %s", got)
+	}
+	stats, _ := backend.Stats()
+	if stats != (QueueStats{Pending: 1, InFlight: 2}) {
+		t.Errorf("Stats() = %#v", stats)
+	}
+
+	_ = taken[0].Ack()
+	_ = taken[1].Nack(time.Now().Add(time.Hour))
+	if err := backend.Offer([]byte(`{"uuid":"4"}`)); err != nil {
+		t.Fatal(err)
+	}
+	pipe := &Pipeline{queuePath: queuePath}
+	next, _ := backend.Take(10)
+	if got := itemData(next, false); !reflect.DeepEqual(got, [][]byte{[]byte(`{"uuid":"3"}`), []byte(`{"uuid":"4"}`)}) {
+		t.Errorf("Take() = %s", got)
+	}
+	_ = pipe.DeadLetter(next[0], DeadCategoryHttp, errors.New("failed"), nil)
+	_ = next[0].Nack(time.Time{})
+	_ = next[1].Ack()
+
+	// Nack 한 것은 retry 파일에서 대기중이다.
+	stats, _ = backend.Stats()
+	if stats != (QueueStats{Pending: 1, Done: 4, Failed: 1}) {
+		t.Errorf("Stats() = %#v", stats)
+	}
+}
@@ -0,0 +1,63 @@
+package queue
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// FileLock 은 flock 으로 잡는 배타 잠금이다. 같은 프로세스 안에서도 FileLock 끼리는 서로 막는다.
+type FileLock struct {
+	Path string
+	file *os.File
+}
+
+func NewFileLock(lockPath string) *FileLock {
+	return &FileLock{Path: lockPath}
+}
+
+// TryLock 은 기다리지 않는다. 다른 쪽이 잡고 있으면 false 를 돌려준다.
+func (l *FileLock) TryLock() (bool, error) {
+	file, err := os.OpenFile(l.Path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return false, err
+	}
+	ok, err := tryLockFile(file)
+	if err != nil || !ok {
+		file.Close()
+		return false, err
+	}
+	l.file = file
+	return true, nil
+}
+
+// Lock 은 잡힐 때까지 기다린다. ctx 가 끝나면 ctx.Err() 를 돌려준다.
+func (l *FileLock) Lock(ctx context.Context) error {
+	for {
+		ok, err := l.TryLock()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Millisecond * 100):
+		}
+	}
+}
+
+func (l *FileLock) Unlock() error {
+	if l.file == nil {
+		return nil
+	}
+	err := unlockFile(l.file)
+	closeErr := l.file.Close()
+	l.file = nil
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
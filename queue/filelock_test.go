@@ -0,0 +1,38 @@
+package queue
+
+import (
+	"context"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestFileLock(t *testing.T) {
+	lockPath := path.Join(testBase, "filelock_test.lock")
+	first := NewFileLock(lockPath)
+	second := NewFileLock(lockPath)
+
+	if ok, err := first.TryLock(); !ok || err != nil {
+		t.Fatalf("TryLock() = %v, %v", ok, err)
+	}
+	if ok, err := second.TryLock(); ok || err != nil {
+		t.Errorf("TryLock() while locked = %v, %v", ok, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+	if err := second.Lock(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Lock() while locked = %v", err)
+	}
+
+	go func() {
+		time.Sleep(time.Millisecond * 200)
+		_ = first.Unlock()
+	}()
+	if err := second.Lock(context.Background()); err != nil {
+		t.Errorf("Lock() after unlock = %v", err)
+	}
+	if err := second.Unlock(); err != nil {
+		t.Errorf("Unlock() = %v", err)
+	}
+}
@@ -1,27 +1,53 @@
 package queue
 
 import (
-	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/sirupsen/logrus"
 	"io"
 	"os"
 	"path"
-	"strings"
+	"sync"
+	"time"
 )
 
 type FileQueue struct {
 	QueuePath     string
 	FileQueueName string
 	Pos           FileQueuePos
+	reserved      int64          // Reserve로 읽어간 위치. Ack 전까지는 Pos.Offset 보다 앞서있다.
+	pending       []*reservation // 예약 순서대로 쌓이고, 앞에서부터 Ack 된 만큼 Pos.Offset 이 전진한다.
+	csv           CsvOptions
+	xlsx          XlsxOptions
+	rd            queueReader
+	rdPos         int64
+	mu            sync.Mutex
 }
 type FileQueuePos struct {
 	Offset    int64
+	Size      int64  `json:",omitempty"` // 싱크할 때의 파일 크기. 이보다 작아지면 잘린 것이다.
+	Inode     uint64 `json:",omitempty"` // 바뀌면 파일이 교체된 것이다.
+	Hash      string `json:",omitempty"` // Offset 직전 hashWindow 바이트의 sha256
+	Length    int64  `json:",omitempty"` // seekable 하지 않은 파일을 끝까지 읽었을 때의 Offset
+	Sheet     string `json:",omitempty"` // .xlsx 에서 읽고 있는 시트
 	LastError string `json:",omitempty"`
 }
 
+// reservation 은 Reserve 한 한 건이 끝나는 위치이다. Data 는 들고 있지 않으므로
+// 앞의 Item 이 오래 Ack 되지 않아도 뒤에서 Ack 된 Item 의 Data 는 메모리에 남지 않는다.
+type reservation struct {
+	end   int64
+	acked bool
+}
+
 var ErrNoData = errors.New("no more data")
+var ErrQuarantined = errors.New("queue file quarantined")
+
+// hashWindow 는 Offset 직전 몇 바이트로 같은 파일인지 확인할지 정한다.
+const hashWindow = 1024
 
 func NewFileQueue(queuePath, queueName string) (*FileQueue, error) {
 
@@ -50,115 +76,323 @@ func NewFileQueue(queuePath, queueName string) (*FileQueue, error) {
 		if err != nil {
 			return nil, err
 		}
+	} else if err != nil {
+		return nil, err
 	} else {
+		// pos 는 rename 으로만 바뀌므로 깨져있다면 누군가 건드린 것이다. 처음부터 다시 읽지 않는다.
 		err = json.Unmarshal(posData, &fq.Pos)
 		if err != nil {
-			logger.Debugf("Use default Pos. %v", err)
-			err := fq.SyncPos()
-			if err != nil {
-				return nil, err
-			}
+			return nil, fq.quarantine(fmt.Sprintf("invalid pos file - %v", err))
+		}
+		err = fq.verifyPos()
+		if err != nil {
+			return nil, fq.quarantine(err.Error())
 		}
 	}
+	fq.reserved = fq.Pos.Offset
 
 	return &fq, nil
 }
 
+// inFlight 는 Reserve 된 뒤 아직 Ack 되지 않은 건수이다.
+func (fq *FileQueue) inFlight() int {
+	fq.mu.Lock()
+	defer fq.mu.Unlock()
+	var n int
+	for _, r := range fq.pending {
+		if !r.acked {
+			n++
+		}
+	}
+	return n
+}
+
+// IsDone 은 생산자가 <이름>.done 파일로 다 썼다고 알렸는지 확인한다.
+// 닫힌 파일은 줄바꿈 없는 마지막 줄도 온전한 한 건으로 읽는다.
+func (fq *FileQueue) IsDone() bool {
+	_, err := os.Stat(path.Join(fq.QueuePath, fq.FileQueueName+".done"))
+	return err == nil
+}
+
 func (fq *FileQueue) IsEOF() bool {
 	subqPath := path.Join(fq.QueuePath, fq.FileQueueName)
 	stat, err := os.Stat(subqPath)
 	if os.IsNotExist(err) {
 		return true
 	}
+	// 압축파일과 .xlsx 는 끝까지 읽어본 뒤에야 길이를 안다.
+	if !fq.seekable() {
+		return fq.Pos.Length > 0 && fq.Pos.Length <= fq.Pos.Offset
+	}
 	if stat.Size() <= fq.Pos.Offset {
 		return true
 	}
 	return false
 }
 
+// SyncPos 는 파일의 크기, inode, Offset 직전 내용의 해시를 같이 남긴다.
+// 임시파일에 쓰고 fsync 후 rename 하므로 중간에 죽어도 이전 pos 나 새 pos 중 하나가 남는다.
 func (fq *FileQueue) SyncPos() error {
+	fqPath := path.Join(fq.QueuePath, fq.FileQueueName)
+	stat, err := os.Stat(fqPath)
+	if err != nil {
+		return err
+	}
+	fq.Pos.Size = stat.Size()
+	fq.Pos.Inode = fileInode(stat)
+	// 압축파일과 .xlsx 의 Offset 은 파일의 바이트 위치가 아니므로 크기와 inode 만 본다.
+	if fq.seekable() {
+		fq.Pos.Hash, err = hashBefore(fqPath, fq.Pos.Offset)
+		if err != nil {
+			return err
+		}
+	}
+	return fq.writePos()
+}
+
+// writePos 는 Pos 를 확인하거나 고치지 않고 그대로 남긴다.
+func (fq *FileQueue) writePos() error {
 	marshaled, _ := json.Marshal(fq.Pos)
 	posPath := path.Join(fq.QueuePath, fq.FileQueueName+".pos")
-	err := os.WriteFile(posPath, marshaled, 0644)
+	return writeFileSync(posPath, marshaled)
+}
+
+// verifyPos 는 pos 를 남긴 뒤에 파일이 잘리거나 교체되지 않았는지 확인한다.
+// 예전 형식의 pos 에는 확인할 값이 없으므로 통과시킨다.
+func (fq *FileQueue) verifyPos() error {
+	fqPath := path.Join(fq.QueuePath, fq.FileQueueName)
+	stat, err := os.Stat(fqPath)
 	if err != nil {
 		return err
 	}
+	if stat.Size() < fq.Pos.Size || (fq.seekable() && stat.Size() < fq.Pos.Offset) {
+		return fmt.Errorf("queue file truncated. size %v < %v", stat.Size(), fq.Pos.Size)
+	}
+	if inode := fileInode(stat); fq.Pos.Inode != 0 && inode != 0 && inode != fq.Pos.Inode {
+		return fmt.Errorf("queue file replaced. inode %v != %v", inode, fq.Pos.Inode)
+	}
+	if fq.Pos.Hash != "" {
+		hash, err := hashBefore(fqPath, fq.Pos.Offset)
+		if err != nil {
+			return err
+		}
+		if hash != fq.Pos.Hash {
+			return fmt.Errorf("queue file changed before offset %v", fq.Pos.Offset)
+		}
+	}
 	return nil
 }
 
-func (fq *FileQueue) Take(n int) [][]byte {
-	logger := logrus.WithFields(logrus.Fields{"ctx": "queue/FileQueue.Take", "path": path.Join(fq.QueuePath, fq.FileQueueName)})
-	file, err := os.OpenFile(path.Join(fq.QueuePath, fq.FileQueueName), os.O_RDONLY, 0)
+func hashBefore(fqPath string, offset int64) (string, error) {
+	if offset <= 0 {
+		return "", nil
+	}
+	file, err := os.Open(fqPath)
 	if err != nil {
-		fq.Pos.LastError = err.Error()
-		return nil
+		return "", err
 	}
 	defer file.Close()
-	_, err = file.Seek(fq.Pos.Offset, io.SeekStart)
+	from := offset - hashWindow
+	if from < 0 {
+		from = 0
+	}
+	h := sha256.New()
+	_, err = io.Copy(h, io.NewSectionReader(file, from, offset-from))
 	if err != nil {
-		fq.Pos.LastError = err.Error()
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Take 는 n개를 읽고 바로 Ack 한다. 결과를 기록한 뒤에 커밋해야 하는 경우 Reserve 를 쓴다.
+func (fq *FileQueue) Take(n int) [][]byte {
+	items := fq.Reserve(n)
+	if items == nil {
 		return nil
 	}
 	var taken = make([][]byte, 0)
+	for _, item := range items {
+		_ = item.Ack()
+		taken = append(taken, item.Data)
+	}
+	return taken
+}
 
-	rd := bufio.NewReader(file)
+// Reserve 는 n개를 읽어 예약만 하고 Pos.Offset 은 건드리지 않는다. 빈 줄은 n 에 세지 않는다.
+// 각 Item 이 Ack 되어야 pos 파일에 반영되므로, 그 전에 죽으면 재시작 후 다시 읽힌다.
+func (fq *FileQueue) Reserve(n int) []*Item {
+	logger := logrus.WithFields(logrus.Fields{"ctx": "queue/FileQueue.Reserve", "path": path.Join(fq.QueuePath, fq.FileQueueName)})
+	fq.mu.Lock()
+	defer fq.mu.Unlock()
 
-	// Take후에는 반드시 싱크
-	defer func(q *FileQueue) {
-		logger.Debug("Sync", fq)
-		err := q.SyncPos()
-		if err != nil {
+	rd, err := fq.reader()
+	if err != nil {
+		fq.Pos.LastError = err.Error()
+		logger.Warnf("Stopped at offset %v. Quarantined on the next run - %v", fq.reserved, err)
+		if err := fq.SyncPos(); err != nil {
 			logger.Debug(err)
 		}
-	}(fq)
+		return nil
+	}
+	defer fq.keepReader()
+	var taken = make([]*Item, 0)
+	var foundLength bool
 
-	var hasRead int64
-	var hasEOF bool
-	for i := 0; i < n; i++ {
-		bytes, err := rd.ReadBytes('\n')
+	for len(taken) < n {
+		bytes, next, err := rd.Next()
+		var rowErr *RowError
+		if errors.As(err, &rowErr) {
+			err = nil
+		}
+		if errors.Is(err, io.EOF) {
+			logger.Debug("Take EOF")
+			if !fq.seekable() && fq.Pos.Length != next {
+				fq.Pos.Length = next
+				foundLength = true
+			}
+			// 헤더처럼 건너뛰기만 한 것은 Ack 된 채로 남겨서 Offset 이 넘어가게 한다.
+			if next > fq.reserved {
+				fq.reserved = next
+				fq.pending = append(fq.pending, &reservation{end: next, acked: true})
+			}
+			break
+		}
+		// 아직 복사중인 압축파일은 다음번에 다시 읽는다.
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			logger.Debug("Wait for the rest. ", err)
+			break
+		}
 		if err != nil {
-			if errors.Is(io.EOF, err) { // err이 있더라도 bytes는 채워져있음
-				logger.Debug("Take EOF")
-				hasEOF = true
-			} else {
-				fq.Pos.LastError = err.Error()
+			fq.Pos.LastError = err.Error()
+			logger.Warnf("Stopped at offset %v. Quarantined on the next run - %v", fq.reserved, err)
+			if err := fq.SyncPos(); err != nil {
 				logger.Debug(err)
-				return nil
 			}
+			return nil
 		}
-		hasRead += int64(len(bytes))
+		fq.reserved = next
 
-		if len(bytes) > 0 && bytes[len(bytes)-1] == '\n' {
-			bytes = bytes[:len(bytes)-1]
+		// 빈 줄은 돌려주지 않지만 Offset 이 건너갈 수 있도록 Ack 된 상태로 남긴다.
+		r := &reservation{end: fq.reserved, acked: len(bytes) == 0}
+		fq.pending = append(fq.pending, r)
+		if r.acked {
+			continue
 		}
-		if len(bytes) > 0 && bytes[len(bytes)-1] == '\r' {
-			bytes = bytes[:len(bytes)-1]
+		item := &Item{Data: bytes, Attempt: 1, queue: fq, reservation: r}
+		if rowErr != nil {
+			item.Err = rowErr
 		}
-		if len(bytes) > 0 {
-			taken = append(taken, bytes)
+		if isRetryQueue(fq.FileQueueName) {
+			item.Data, item.Attempt = unwrapRetry(bytes)
 		}
-		if hasEOF {
-			break
+		taken = append(taken, item)
+	}
+	fq.commit(logger)
+	if foundLength {
+		if err := fq.SyncPos(); err != nil {
+			logger.Debug(err)
 		}
 	}
-	fq.Pos.Offset += hasRead
 
 	return taken
 }
 
+// reader 는 fq.reserved 부터 읽는다. 압축파일과 .xlsx 는 처음부터 다시 읽지 않도록 열어둔 것을 이어서 쓴다.
+func (fq *FileQueue) reader() (queueReader, error) {
+	if fq.rd != nil && fq.rdPos == fq.reserved {
+		return fq.rd, nil
+	}
+	fq.closeReader()
+	rd, err := fq.openReader(fq.reserved)
+	if err != nil {
+		return nil, err
+	}
+	fq.rd = rd
+	return rd, nil
+}
+
+// keepReader 는 seekable 하지 않은 파일만 열어둔다. 평문은 seek 이 싸고, 다시 열어야 그동안 덧붙여진 것을 읽는다.
+func (fq *FileQueue) keepReader() {
+	if fq.seekable() || fq.Pos.LastError != "" {
+		fq.closeReader()
+		return
+	}
+	fq.rdPos = fq.reserved
+}
+
+func (fq *FileQueue) closeReader() {
+	if fq.rd != nil {
+		fq.rd.Close()
+		fq.rd = nil
+	}
+}
+
+// Close 는 열어둔 압축파일이나 .xlsx 를 닫는다.
+func (fq *FileQueue) Close() error {
+	fq.mu.Lock()
+	defer fq.mu.Unlock()
+	fq.closeReader()
+	return nil
+}
+
+func (fq *FileQueue) ack(item *Item) error {
+	fq.mu.Lock()
+	defer fq.mu.Unlock()
+	item.reservation.acked = true
+	return fq.commit(logrus.WithFields(logrus.Fields{"ctx": "queue/FileQueue.ack", "path": path.Join(fq.QueuePath, fq.FileQueueName)}))
+}
+
+// commit 은 앞에서부터 연속으로 Ack 된 Item 까지 Pos.Offset 을 옮기고 싱크한다.
+func (fq *FileQueue) commit(logger *logrus.Entry) error {
+	var done int
+	for done < len(fq.pending) && fq.pending[done].acked {
+		fq.Pos.Offset = fq.pending[done].end
+		done++
+	}
+	if done == 0 {
+		return nil
+	}
+	fq.pending = fq.pending[done:]
+	logger.Debug("Sync", fq.Pos)
+	err := fq.SyncPos()
+	if err != nil {
+		logger.Debug(err)
+	}
+	return err
+}
+
 func OfferFileQueue(queuePath string) (*FileQueue, error) {
+	targets, err := ListFileQueues(queuePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) > 0 {
+		return targets[0], nil
+	} else {
+		return nil, ErrNoData
+	}
+}
+
+// ListFileQueues 는 읽을 것이 남은 큐파일들을 이름순으로 돌려준다.
+func ListFileQueues(queuePath string) ([]*FileQueue, error) {
 	logger := logrus.WithField("path", queuePath)
 	dirs, err := os.ReadDir(queuePath)
 	if err != nil {
 		return nil, err
 	}
+	now := time.Now()
 	// 디렉토리와 "_" 로 시작하는 파일 제거
 	var targets []*FileQueue
 	for _, d := range dirs {
 		if d.IsDir() {
 			continue
 		}
-		if !strings.HasSuffix(d.Name(), ".jsonl") {
+		// 생산자는 .jsonl.tmp 같은 이름으로 다 쓴 뒤 rename 하면 쓰는 중인 파일이 읽히지 않는다.
+		if !IsQueueFileName(d.Name()) {
+			continue
+		}
+		if notBefore, ok := retryNotBefore(d.Name()); ok && notBefore.After(now) {
+			logger.WithField("dir", d.Name()).Debug("Skip by NotBefore")
 			continue
 		}
 		// 정합성 체크를 여기서 끝낸다.
@@ -182,9 +416,5 @@ func OfferFileQueue(queuePath string) (*FileQueue, error) {
 	//	compare := strings.Compare(targets[i].Name(), targets[j].Name())
 	//	return compare == -1
 	//})
-	if len(targets) > 0 {
-		return targets[0], nil
-	} else {
-		return nil, ErrNoData
-	}
+	return targets, nil
 }
@@ -1,6 +1,7 @@
 package queue
 
 import (
+	"errors"
 	log "github.com/sirupsen/logrus"
 	"os"
 	"path"
@@ -127,9 +128,17 @@ func TestFileQueue_Take(t *testing.T) {
 			want: [][]byte{
 				[]byte("0"),
 				[]byte("1"),
-				[]byte("2"),
 			},
 		},
+		{
+			name: "data3",
+			fields: fields{
+				QueuePath:    path.Join(testBase, "filequeue_take_test1"),
+				SubQueueName: "data3.jsonl",
+			},
+			args: args{5},
+			want: [][]byte{},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -150,6 +159,25 @@ func TestFileQueue_Take(t *testing.T) {
 	cont, _ := os.ReadFile(filename)
 	log.Println(cont)
 
+	// 줄바꿈이 붙으면 남아있던 마지막 줄을 읽는다.
+	filename = path.Join(testBase, "filequeue_take_test1", "data3.jsonl")
+	file, err = os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		log.Println(err)
+	}
+	file.Write([]byte("\n3"))
+	file.Close()
+
+	// .done 이 있으면 줄바꿈 없는 마지막 줄도 읽는다.
+	filename = path.Join(testBase, "filequeue_take_test1", "data4.jsonl")
+	file, err = os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		log.Println(err)
+	}
+	file.Write([]byte("4"))
+	file.Close()
+	_ = os.WriteFile(filename+".done", nil, 0644)
+
 	tests2 := []struct {
 		name   string
 		fields fields
@@ -165,6 +193,24 @@ func TestFileQueue_Take(t *testing.T) {
 			args: args{4},
 			want: [][]byte{[]byte("3")},
 		},
+		{
+			name: "data3",
+			fields: fields{
+				QueuePath:    path.Join(testBase, "filequeue_take_test1"),
+				SubQueueName: "data3.jsonl",
+			},
+			args: args{4},
+			want: [][]byte{[]byte("2")},
+		},
+		{
+			name: "data4",
+			fields: fields{
+				QueuePath:    path.Join(testBase, "filequeue_take_test1"),
+				SubQueueName: "data4.jsonl",
+			},
+			args: args{10},
+			want: [][]byte{[]byte("0"), []byte("1"), []byte("2"), []byte("4")},
+		},
 	}
 	for _, tt := range tests2 {
 		t.Run(tt.name, func(t *testing.T) {
@@ -175,3 +221,104 @@ func TestFileQueue_Take(t *testing.T) {
 		})
 	}
 }
+
+func TestFileQueue_SyncPosIntegrity(t *testing.T) {
+	queuePath := path.Join(testBase, "filequeue_integrity_test1")
+	_ = os.MkdirAll(queuePath, 0755)
+	write := func(name, data string) {
+		if err := os.WriteFile(path.Join(queuePath, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	take := func(name string) error {
+		fq, err := NewFileQueue(queuePath, name)
+		if err != nil {
+			return err
+		}
+		fq.Take(1)
+		return nil
+	}
+
+	tests := []struct {
+		name    string
+		change  func(name string)
+		wantErr bool
+	}{
+		{name: "appended", change: func(name string) {
+			file, _ := os.OpenFile(path.Join(queuePath, name), os.O_APPEND|os.O_WRONLY, 0)
+			file.Write([]byte("3\n"))
+			file.Close()
+		}, wantErr: false},
+		{name: "truncated", change: func(name string) {
+			_ = os.Truncate(path.Join(queuePath, name), 2)
+		}, wantErr: true},
+		{name: "rewritten", change: func(name string) {
+			write(name, "9\n9\n9\n")
+		}, wantErr: true},
+		{name: "replaced", change: func(name string) {
+			write(name+".new", "0\n1\n2\n")
+			_ = os.Rename(path.Join(queuePath, name+".new"), path.Join(queuePath, name))
+		}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := tt.name + ".jsonl"
+			write(name, "0\n1\n2\n")
+			if err := take(name); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(path.Join(queuePath, name+".pos.tmp")); !os.IsNotExist(err) {
+				t.Errorf("pos tmp file left")
+			}
+			tt.change(name)
+
+			_, err := NewFileQueue(queuePath, name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewFileQueue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrQuarantined) {
+					t.Errorf("NewFileQueue() error = %v", err)
+				}
+				if _, err := os.Stat(path.Join(queuePath, QuarantineDir, name+".pos")); err != nil {
+					t.Errorf("not quarantined - %v", err)
+				}
+				if _, err := os.Stat(path.Join(queuePath, name)); !os.IsNotExist(err) {
+					t.Errorf("queue file left")
+				}
+			}
+		})
+	}
+}
+
+func TestFileQueue_TakeCompressed(t *testing.T) {
+	queuePath := path.Join(testBase, "filequeue_compressed_test1")
+	for _, name := range []string{"data.jsonl.gz", "data.jsonl.zst"} {
+		t.Run(name, func(t *testing.T) {
+			fq, err := NewFileQueue(queuePath, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fq.Take(2); !reflect.DeepEqual(got, [][]byte{[]byte(`{"uuid":"1"}`), []byte(`{"uuid":"2"}`)}) {
+				t.Errorf("Take() = %s", got)
+			}
+			fq.Close()
+
+			// 새로 열어도 압축을 푼 위치부터 이어서 읽는다.
+			fq, err = NewFileQueue(queuePath, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fq.Close()
+			if fq.IsEOF() {
+				t.Errorf("IsEOF() = true")
+			}
+			if got := fq.Take(10); !reflect.DeepEqual(got, [][]byte{[]byte(`{"uuid":"3"}`), []byte(`{"uuid":"4"}`)}) {
+				t.Errorf("Take() = %s", got)
+			}
+			if !fq.IsEOF() {
+				t.Errorf("IsEOF() = false, Pos = %#v", fq.Pos)
+			}
+		})
+	}
+}
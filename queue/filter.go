@@ -0,0 +1,32 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"github.com/PaesslerAG/gval"
+	"github.com/PaesslerAG/jsonpath"
+)
+
+// filterBuilder 는 tmpl 과 같은 식을 쓴다. 예: $.status == "active" && $.count > 0
+var filterBuilder = gval.Full(jsonpath.PlaceholderExtension())
+
+func (pipe *Pipeline) loadFilter() error {
+	if pipe.Filter == "" {
+		return nil
+	}
+	filter, err := filterBuilder.NewEvaluable(pipe.Filter)
+	if err != nil {
+		return fmt.Errorf("Filter %v - %w", pipe.Filter, err)
+	}
+	pipe.filter = filter
+	return nil
+}
+
+// Match 는 Filter 가 없거나 o 에서 참이면 true 이다.
+// 식을 계산하지 못하면 false 와 그 이유를 돌려준다. 없는 키를 찾는 경우가 대부분이다.
+func (pipe *Pipeline) Match(o interface{}) (bool, error) {
+	if pipe.filter == nil {
+		return true, nil
+	}
+	return pipe.filter.EvalBool(context.Background(), o)
+}
@@ -0,0 +1,38 @@
+package queue
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPipeline_Match(t *testing.T) {
+	pipe, err := NewPipeline(testBase, []byte(`{"OutputPath":"out.log","UniqueKey":"$.id","Filter":"$.status == \"active\" && $.count > 1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		data    string
+		want    bool
+		wantErr bool
+	}{
+		{data: `{"status":"active","count":2}`, want: true},
+		{data: `{"status":"active","count":1}`, want: false},
+		{data: `{"status":"closed","count":2}`, want: false},
+		{data: `{"count":2}`, want: false, wantErr: true},
+	}
+	for _, tt := range tests {
+		var o interface{}
+		_ = json.Unmarshal([]byte(tt.data), &o)
+		got, err := pipe.Match(o)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("Match(%v) = %v, %v, want %v", tt.data, got, err, tt.want)
+		}
+	}
+
+	if _, err := NewPipeline(testBase, []byte(`{"OutputPath":"out.log","UniqueKey":"$.id","Filter":"$.status =="}`)); err == nil {
+		t.Errorf("NewPipeline() with invalid Filter")
+	}
+	if matched, err := (&Pipeline{}).Match(map[string]interface{}{}); !matched || err != nil {
+		t.Errorf("Match() without Filter = %v, %v", matched, err)
+	}
+}
@@ -0,0 +1,50 @@
+package queue
+
+import (
+	"os"
+	"path"
+)
+
+func appendLine(filePath string, line []byte) error {
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		file.Close()
+		return err
+	}
+	err = file.Sync()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// writeFileSync 는 임시파일에 다 쓴 뒤 rename 해서, 큐파일이 반쯤 쓰인 채로 읽히지 않게 한다.
+func writeFileSync(filePath string, data []byte) error {
+	tmpPath := filePath + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	err = os.Rename(tmpPath, filePath)
+	if err != nil {
+		return err
+	}
+	// rename 까지 디스크에 남도록 디렉토리도 싱크한다.
+	return syncDir(path.Dir(filePath))
+}
@@ -0,0 +1,13 @@
+package queue
+
+import "os"
+
+// 윈도우는 디렉토리를 열어서 싱크할 수 없다.
+func syncDir(dirPath string) error {
+	return nil
+}
+
+// 윈도우에서는 inode 를 비교하지 않는다.
+func fileInode(info os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,240 @@
+package queue
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// INBOX 백엔드는 inbox/ 의 *.json 파일 하나를 한 건으로 읽는다.
+// 읽을 때 processing/ 으로 rename 해서 가져가므로 같은 파일을 두 곳에서 가져갈 수 없고,
+// 끝나면 processed/ 나 failed/ 로 옮긴다. 생산자도 다른 이름으로 다 쓴 뒤 rename 으로 넣어야 한다.
+const InboxDir = "inbox"
+const ProcessingDir = "processing"
+const ProcessedDir = "processed"
+const FailedDir = "failed"
+
+const suffixJson = ".json"
+
+// IsInboxFileName 은 inbox/ 에서 한 건으로 읽는 이름인지 확인한다.
+func IsInboxFileName(name string) bool {
+	return strings.HasSuffix(name, suffixJson) && !strings.HasPrefix(name, ".")
+}
+
+type InboxBackend struct {
+	QueuePath string
+	recovered bool
+	mu        sync.Mutex
+}
+
+func NewInboxBackend(queuePath string) (*InboxBackend, error) {
+	for _, dir := range []string{InboxDir, ProcessingDir} {
+		err := os.MkdirAll(path.Join(queuePath, dir), 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &InboxBackend{QueuePath: queuePath}, nil
+}
+
+// inboxOfferSeq 는 같은 시각에 Offer 한 것들의 이름이 겹치지 않게 한다.
+var inboxOfferSeq uint64
+
+// Offer 는 임시파일에 다 쓴 뒤 inbox/ 로 rename 한다.
+// 이름에 pid 와 순번을 붙여서 여러 건을 한꺼번에 넣어도 서로 덮어쓰지 않는다.
+func (backend *InboxBackend) Offer(data []byte) error {
+	seq := atomic.AddUint64(&inboxOfferSeq, 1)
+	name := fmt.Sprintf("offer-%v-%v-%08d%v", time.Now().UTC().Format("20060102T150405.000000000"), os.Getpid(), seq, suffixJson)
+	return writeFileSync(path.Join(backend.QueuePath, InboxDir, name), data)
+}
+
+func (backend *InboxBackend) Take(n int) ([]*Item, error) {
+	logger := logrus.WithFields(logrus.Fields{"ctx": "queue/InboxBackend.Take", "path": backend.QueuePath})
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	var taken = make([]*Item, 0)
+	if n <= 0 {
+		return taken, nil
+	}
+	// 지난 실행이 끝내지 못한 것은 inbox/ 로 되돌린다.
+	// Take 는 파이프라인 잠금 안에서만 불리므로 다른 실행이 가져간 것을 건드리지 않는다.
+	if !backend.recovered {
+		err := backend.recover()
+		if err != nil {
+			return taken, err
+		}
+		backend.recovered = true
+	}
+
+	inboxPath := path.Join(backend.QueuePath, InboxDir)
+	dirs, err := os.ReadDir(inboxPath)
+	if err != nil {
+		return taken, err
+	}
+	now := time.Now()
+	for _, d := range dirs {
+		if len(taken) >= n {
+			break
+		}
+		if d.IsDir() || !IsInboxFileName(d.Name()) {
+			continue
+		}
+		name := parseInboxName(d.Name())
+		if now.Before(name.notBefore) {
+			logger.Debug("Skip by NotBefore ", d.Name())
+			continue
+		}
+		processingPath := path.Join(backend.QueuePath, ProcessingDir, d.Name())
+		err := os.Rename(path.Join(inboxPath, d.Name()), processingPath)
+		if os.IsNotExist(err) {
+			// 다른 곳에서 먼저 가져갔다.
+			continue
+		}
+		if err != nil {
+			return taken, err
+		}
+		data, err := os.ReadFile(processingPath)
+		if err != nil {
+			return taken, err
+		}
+		taken = append(taken, &Item{Data: data, Attempt: name.attempt, backend: backend, source: d.Name()})
+	}
+	return taken, nil
+}
+
+// recover 는 processing/ 에 남은 파일을 inbox/ 로 되돌린다.
+func (backend *InboxBackend) recover() error {
+	dirs, err := os.ReadDir(path.Join(backend.QueuePath, ProcessingDir))
+	if err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		if d.IsDir() {
+			continue
+		}
+		err := os.Rename(path.Join(backend.QueuePath, ProcessingDir, d.Name()), path.Join(backend.QueuePath, InboxDir, d.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return syncDir(path.Join(backend.QueuePath, InboxDir))
+}
+
+func (backend *InboxBackend) Ack(item *Item) error {
+	return backend.finish(item, ProcessedDir)
+}
+
+// Nack 은 retry-<시각>-<시도>-<이름>.json 으로 inbox/ 에 되돌린다. 그 시각 전에는 Take 하지 않는다.
+func (backend *InboxBackend) Nack(item *Item, retryAt time.Time) error {
+	if retryAt.IsZero() {
+		return backend.finish(item, FailedDir)
+	}
+	return backend.requeue(item, item.Attempt+1, retryAt)
+}
+
+func (backend *InboxBackend) Defer(item *Item, notBefore time.Time) error {
+	return backend.requeue(item, item.Attempt, notBefore)
+}
+
+func (backend *InboxBackend) requeue(item *Item, attempt int, at time.Time) error {
+	name := parseInboxName(item.source)
+	name.attempt = attempt
+	name.notBefore = at.UTC().Truncate(time.Second).Add(time.Second)
+	err := os.Rename(path.Join(backend.QueuePath, ProcessingDir, item.source), path.Join(backend.QueuePath, InboxDir, name.String()))
+	if err != nil {
+		return err
+	}
+	return syncDir(path.Join(backend.QueuePath, InboxDir))
+}
+
+// finish 는 원래 이름으로 dir 에 옮긴다. 같은 이름이 이미 있으면 시각을 붙인다.
+func (backend *InboxBackend) finish(item *Item, dir string) error {
+	dirPath := path.Join(backend.QueuePath, dir)
+	err := os.MkdirAll(dirPath, 0755)
+	if err != nil {
+		return err
+	}
+	name := parseInboxName(item.source).name
+	if _, err := os.Stat(path.Join(dirPath, name)); err == nil {
+		name = fmt.Sprintf("%v.%v", name, time.Now().Format("20060102T150405.000000000"))
+	}
+	err = os.Rename(path.Join(backend.QueuePath, ProcessingDir, item.source), path.Join(dirPath, name))
+	if err != nil {
+		return err
+	}
+	return syncDir(dirPath)
+}
+
+func (backend *InboxBackend) Stats() (QueueStats, error) {
+	var stats QueueStats
+	for _, count := range []struct {
+		dir string
+		n   *int64
+	}{
+		{InboxDir, &stats.Pending},
+		{ProcessingDir, &stats.InFlight},
+		{ProcessedDir, &stats.Done},
+		{FailedDir, &stats.Failed},
+	} {
+		dirs, err := os.ReadDir(path.Join(backend.QueuePath, count.dir))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return stats, err
+		}
+		for _, d := range dirs {
+			// inbox/ 에서 아직 쓰고 있는 임시파일은 세지 않는다.
+			if d.IsDir() || count.dir == InboxDir && !IsInboxFileName(d.Name()) {
+				continue
+			}
+			*count.n++
+		}
+	}
+	return stats, nil
+}
+
+func (backend *InboxBackend) Close() error {
+	return nil
+}
+
+// inboxName 은 inbox/ 의 파일이름에 담긴 원래 이름, 시도횟수, 재시도 시각이다.
+type inboxName struct {
+	name      string
+	attempt   int
+	notBefore time.Time
+}
+
+func parseInboxName(fileName string) inboxName {
+	parsed := inboxName{name: fileName, attempt: 1}
+	if !strings.HasPrefix(fileName, retryPrefix) {
+		return parsed
+	}
+	parts := strings.SplitN(strings.TrimPrefix(fileName, retryPrefix), "-", 3)
+	if len(parts) != 3 {
+		return parsed
+	}
+	notBefore, err := time.Parse(retryTimeFormat, parts[0])
+	if err != nil {
+		return parsed
+	}
+	attempt, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return parsed
+	}
+	return inboxName{name: parts[2], attempt: attempt, notBefore: notBefore}
+}
+
+func (name inboxName) String() string {
+	if name.notBefore.IsZero() {
+		return name.name
+	}
+	return retryPrefix + name.notBefore.Format(retryTimeFormat) + "-" + strconv.Itoa(name.attempt) + "-" + name.name
+}
@@ -0,0 +1,84 @@
+package queue
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInboxBackend(t *testing.T) {
+	queuePath := path.Join(testBase, "inbox_test1")
+	backend, err := NewInboxBackend(queuePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 지난 실행이 processing/ 에 남긴 것부터 다시 나온다.
+	taken, err := backend.Take(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sources []string
+	for _, item := range taken {
+		sources = append(sources, item.Source())
+	}
+	if !reflect.DeepEqual(sources, []string{"0.json", "1.json", "2.json", "3.json"}) {
+		t.Fatalf("Take() = %v", sources)
+	}
+	if string(taken[2].Data) != "{\n  \"uuid\": \"2\"\n}\n" {
+		t.Errorf("Data = %q", taken[2].Data)
+	}
+
+	_ = taken[0].Ack()
+	_ = taken[1].Nack(time.Now().Add(time.Hour))
+	_ = taken[2].Nack(time.Time{})
+	stats, _ := backend.Stats()
+	if stats != (QueueStats{Pending: 1, InFlight: 1, Done: 1, Failed: 1}) {
+		t.Errorf("Stats() = %#v", stats)
+	}
+	for _, name := range []string{path.Join(ProcessedDir, "0.json"), path.Join(FailedDir, "2.json")} {
+		if _, err := os.Stat(path.Join(queuePath, name)); err != nil {
+			t.Errorf("not moved - %v", err)
+		}
+	}
+
+	// 새 백엔드는 끝나지 않은 3.json 을 되돌려 받고, 재시도 시각 전인 1.json 은 가져가지 않는다.
+	backend, _ = NewInboxBackend(queuePath)
+	taken, _ = backend.Take(10)
+	if len(taken) != 1 || taken[0].Source() != "3.json" || taken[0].Attempt != 1 {
+		t.Fatalf("Take() = %#v", taken)
+	}
+	_ = taken[0].Ack()
+	if err := backend.Offer([]byte(`{"uuid":"5"}`)); err != nil {
+		t.Fatal(err)
+	}
+	taken, _ = backend.Take(10)
+	if len(taken) != 1 || string(taken[0].Data) != `{"uuid":"5"}` {
+		t.Fatalf("Take() = %#v", taken)
+	}
+}
+
+func Test_parseInboxName(t *testing.T) {
+	notBefore := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		fileName string
+		want     inboxName
+	}{
+		{fileName: "a-1.json", want: inboxName{name: "a-1.json", attempt: 1}},
+		{fileName: "retry-20220102T030405Z-3-a-1.json", want: inboxName{name: "a-1.json", attempt: 3, notBefore: notBefore}},
+		{fileName: "retry-x-3-a.json", want: inboxName{name: "retry-x-3-a.json", attempt: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fileName, func(t *testing.T) {
+			got := parseInboxName(tt.fileName)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseInboxName() = %#v, want %#v", got, tt.want)
+			}
+			if got.String() != tt.fileName {
+				t.Errorf("String() = %v", got.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package queue
+
+import "time"
+
+// Item 은 큐에서 꺼낸 한 건이다. 결과를 남긴 뒤 Ack 해야 큐의 위치가 전진한다.
+type Item struct {
+	Data        []byte
+	Attempt     int   // 첫 시도는 1
+	Err         error // .csv/.tsv/.xlsx 의 행을 JSON 으로 바꾸지 못한 이유. 이때 Data 는 원본 행이다.
+	backend     QueueBackend
+	source      string
+	queue       *FileQueue   // FileQueue 에서 읽은 경우
+	reservation *reservation // FileQueue 에서 예약한 범위
+	id          int64        // SqliteBackend 의 행 번호
+}
+
+func (item *Item) Ack() error {
+	return item.queueBackend().Ack(item)
+}
+
+// Nack 은 retryAt 이후에 다음 시도로 다시 나오게 한다. retryAt 이 zero 면 더 시도하지 않는다.
+func (item *Item) Nack(retryAt time.Time) error {
+	return item.queueBackend().Nack(item, retryAt)
+}
+
+// Source 는 Item 을 읽어온 큐파일 이름이다.
+func (item *Item) Source() string {
+	if item.queue != nil {
+		return item.queue.FileQueueName
+	}
+	return item.source
+}
+
+// Defer 는 아직 때가 되지 않은 Item 을 시도로 세지 않고 notBefore 이후로 미룬다.
+func (item *Item) Defer(notBefore time.Time) error {
+	return item.queueBackend().Defer(item, notBefore)
+}
+
+// queueBackend 는 FileQueue.Reserve 로 바로 꺼낸 Item 이면 큐파일 옆에 retry 파일을 쓰는 FileBackend 이다.
+func (item *Item) queueBackend() QueueBackend {
+	if item.backend == nil {
+		return NewFileBackend(item.queue.QueuePath, false)
+	}
+	return item.backend
+}
@@ -0,0 +1,162 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// LaneStateName 은 WeightedFair 에서 lane 마다 쌓인 몫을 실행 사이에 남기는 파일이다.
+const LaneStateName = "_lanes.json"
+
+type Lane struct {
+	Prefix string // 큐파일 이름이 이것으로 시작하면 이 lane 이다. "" 는 어느 Prefix 에도 맞지 않는 나머지이다.
+	Weight int    // WeightedFair 에서 이 lane 의 몫. 0 이면 1 이다.
+}
+
+// PriorityPolicy 는 큐파일 이름의 Prefix 로 lane 을 나눈다. Lanes 는 앞의 것이 우선이다.
+// Prefix "" 인 lane 이 없으면 나머지 큐파일은 마지막 lane 뒤에 Weight 1 로 둔다.
+// retry-, offer- 큐파일도 이름대로 나누므로 대개 나머지 lane 으로 간다.
+type PriorityPolicy struct {
+	Lanes        []Lane
+	WeightedFair bool // true 면 Weight 대로 나눠서 가져간다. false 면 앞의 lane 이 빌 때까지 뒤의 lane 은 기다린다.
+}
+
+func (policy PriorityPolicy) validate() error {
+	seen := map[string]bool{}
+	for _, lane := range policy.Lanes {
+		if seen[lane.Prefix] {
+			return fmt.Errorf("duplicated Priority.Lanes Prefix %q", lane.Prefix)
+		}
+		seen[lane.Prefix] = true
+		if lane.Weight < 0 {
+			return fmt.Errorf("negative Priority.Lanes Weight for %q", lane.Prefix)
+		}
+	}
+	return nil
+}
+
+// lanes 는 나머지 lane 까지 채운 목록이다.
+func (policy PriorityPolicy) lanes() []Lane {
+	lanes := make([]Lane, 0, len(policy.Lanes)+1)
+	var rest bool
+	for _, lane := range policy.Lanes {
+		if lane.Weight == 0 {
+			lane.Weight = 1
+		}
+		if lane.Prefix == "" {
+			rest = true
+		}
+		lanes = append(lanes, lane)
+	}
+	if !rest {
+		lanes = append(lanes, Lane{Weight: 1})
+	}
+	return lanes
+}
+
+// laneOf 는 name 에 맞는 lane 중 Prefix 가 가장 긴 것이다.
+func laneOf(lanes []Lane, name string) int {
+	found, longest := -1, -1
+	for i, lane := range lanes {
+		if strings.HasPrefix(name, lane.Prefix) && len(lane.Prefix) > longest {
+			found, longest = i, len(lane.Prefix)
+		}
+	}
+	return found
+}
+
+// takeLanes 는 lane 마다 큐파일을 이름순으로 읽어서 n 개까지 예약한다.
+func (backend *FileBackend) takeLanes(queues []*FileQueue, n int) ([]*Item, error) {
+	lanes := backend.Priority.lanes()
+	laneQueues := make([][]*FileQueue, len(lanes))
+	for _, queue := range queues {
+		i := laneOf(lanes, queue.FileQueueName)
+		laneQueues[i] = append(laneQueues[i], queue)
+	}
+	// reserve 는 lane 에서 k 개까지 예약한다. 다 읽은 큐파일은 목록에서 뺀다.
+	reserve := func(i int, k int) []*Item {
+		var taken []*Item
+		for len(laneQueues[i]) > 0 && len(taken) < k {
+			reserved := laneQueues[i][0].Reserve(k - len(taken))
+			if len(reserved) < k-len(taken) {
+				laneQueues[i] = laneQueues[i][1:]
+			}
+			taken = append(taken, reserved...)
+		}
+		return taken
+	}
+
+	var gTaken = make([]*Item, 0)
+	if !backend.Priority.WeightedFair {
+		for i := range lanes {
+			gTaken = append(gTaken, reserve(i, n-len(gTaken))...)
+		}
+		return gTaken, nil
+	}
+
+	// smooth weighted round robin 으로 한 건씩 고른다. 몫은 실행이 바뀌어도 이어지므로
+	// TakePerTick 이 작아도 뒤의 lane 이 계속 밀리지 않는다.
+	current, err := backend.loadLaneState(lanes)
+	if err != nil {
+		return gTaken, err
+	}
+	for len(gTaken) < n {
+		var total int
+		picked := -1
+		for i, lane := range lanes {
+			if len(laneQueues[i]) == 0 {
+				continue
+			}
+			current[lane.Prefix] += lane.Weight
+			total += lane.Weight
+			if picked < 0 || current[lane.Prefix] > current[lanes[picked].Prefix] {
+				picked = i
+			}
+		}
+		if picked < 0 {
+			break
+		}
+		taken := reserve(picked, 1)
+		if len(taken) == 0 {
+			// 고른 lane 이 비어있었으므로 이번 몫은 되돌린다.
+			for i, lane := range lanes {
+				if len(laneQueues[i]) > 0 || i == picked {
+					current[lane.Prefix] -= lane.Weight
+				}
+			}
+			continue
+		}
+		current[lanes[picked].Prefix] -= total
+		gTaken = append(gTaken, taken...)
+	}
+	return gTaken, backend.saveLaneState(current)
+}
+
+// loadLaneState 는 _lanes.json 의 몫을 읽는다. 설정에서 빠진 lane 은 버린다.
+func (backend *FileBackend) loadLaneState(lanes []Lane) (map[string]int, error) {
+	current := map[string]int{}
+	b, err := os.ReadFile(path.Join(backend.QueuePath, LaneStateName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		var saved map[string]int
+		if json.Unmarshal(b, &saved) == nil {
+			for _, lane := range lanes {
+				current[lane.Prefix] = saved[lane.Prefix]
+			}
+		}
+	}
+	return current, nil
+}
+
+func (backend *FileBackend) saveLaneState(current map[string]int) error {
+	b, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	return writeFileSync(path.Join(backend.QueuePath, LaneStateName), b)
+}
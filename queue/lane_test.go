@@ -0,0 +1,66 @@
+package queue
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func takeIds(t *testing.T, backend *FileBackend, n int) []string {
+	var ids []string
+	for _, item := range mustTake(t, backend, n) {
+		var o struct{ Id string }
+		_ = json.Unmarshal(item.Data, &o)
+		ids = append(ids, o.Id)
+		_ = item.Ack()
+	}
+	return ids
+}
+
+func TestFileBackend_TakeLanes(t *testing.T) {
+	backend := NewFileBackend(path.Join(testBase, "lane_test1"), false)
+	backend.Priority = PriorityPolicy{Lanes: []Lane{{Prefix: "high-"}, {Prefix: ""}, {Prefix: "low-"}}}
+	defer backend.Close()
+
+	tests := []struct {
+		n    int
+		want []string
+	}{
+		{n: 3, want: []string{"high-a1", "high-a2", "high-a3"}},
+		{n: 3, want: []string{"high-a4", "data1", "data2"}},
+		{n: 4, want: []string{"data3", "data4", "low-a1", "low-a2"}},
+		{n: 4, want: []string{"low-a3", "low-a4"}},
+	}
+	for _, tt := range tests {
+		if got := takeIds(t, backend, tt.n); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Take(%v) = %v, want %v", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestFileBackend_TakeLanesWeightedFair(t *testing.T) {
+	queuePath := path.Join(testBase, "lane_test2")
+	policy := PriorityPolicy{Lanes: []Lane{{Prefix: "high-", Weight: 2}, {Prefix: "low-"}}, WeightedFair: true}
+
+	// 실행마다 한 건씩 가져가도 몫이 이어져서 낮은 lane 도 차례가 온다.
+	var got []string
+	for i := 0; i < 8; i++ {
+		backend := NewFileBackend(queuePath, false)
+		backend.Priority = policy
+		got = append(got, takeIds(t, backend, 1)...)
+		backend.Close()
+	}
+	want := []string{"high-a1", "low-a1", "data1", "high-a2", "high-a3", "low-a2", "data2", "high-a4"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Take(1) x 8 = %v, want %v", got, want)
+	}
+
+	// high 가 비면 나머지가 나눠 가진다.
+	backend := NewFileBackend(queuePath, false)
+	backend.Priority = policy
+	defer backend.Close()
+	if got := takeIds(t, backend, 10); len(got) != 4 {
+		t.Errorf("Take(10) = %v", got)
+	}
+}
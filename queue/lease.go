@@ -0,0 +1,117 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"time"
+)
+
+// LeaseName 은 여러 프로세스가 같은 queuebase 를 쓸 때 파이프라인의 주인을 적어두는 파일이다.
+const LeaseName = "_lease.json"
+
+// MinLeaseTTL 보다 짧은 lease 는 갱신하기 전에 만료된다.
+const MinLeaseTTL = time.Second
+
+var ErrLeaseHeld = errors.New("lease held by other owner")
+
+// Lease 는 만료되기 전까지 Owner 만 파이프라인을 돌릴 수 있게 한다.
+// 실행이 끝나도 바로 놓지 않으므로, 주인이 살아있는 동안에는 다음 실행도 같은 주인이 맡는다.
+type Lease struct {
+	Owner     string
+	Expires   time.Time
+	leasePath string
+	ttl       time.Duration
+}
+
+func (pipe *Pipeline) LeasePath() string {
+	return path.Join(pipe.queuePath, LeaseName)
+}
+
+// AcquireLease 는 lease 가 없거나 만료되었거나 이미 owner 의 것이면 ttl 만큼 잡는다.
+// 읽고 쓰는 사이는 flock 으로 막고, 쓰기는 rename 이라 중간에 죽어도 lease 파일이 깨지지 않는다.
+func AcquireLease(leasePath, owner string, ttl time.Duration) (*Lease, error) {
+	lock := NewFileLock(leasePath + ".lock")
+	err := lock.Lock(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
+	current, err := readLease(leasePath)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if current != nil && current.Owner != owner && now.Before(current.Expires) {
+		return current, ErrLeaseHeld
+	}
+
+	lease := &Lease{Owner: owner, Expires: now.Add(ttl), leasePath: leasePath, ttl: ttl}
+	marshaled, _ := json.Marshal(lease)
+	err = writeFileSync(leasePath, marshaled)
+	if err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+// ReleaseLease 는 owner 가 잡고 있는 lease 를 지워서 다른 프로세스가 바로 넘겨받게 한다.
+func ReleaseLease(leasePath, owner string) error {
+	lock := NewFileLock(leasePath + ".lock")
+	err := lock.Lock(context.Background())
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	current, err := readLease(leasePath)
+	if err != nil || current == nil || current.Owner != owner {
+		return err
+	}
+	return os.Remove(leasePath)
+}
+
+func readLease(leasePath string) (*Lease, error) {
+	data, err := os.ReadFile(leasePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var lease Lease
+	// 읽을 수 없는 lease 는 없는 것으로 본다.
+	if err := json.Unmarshal(data, &lease); err != nil {
+		return nil, nil
+	}
+	return &lease, nil
+}
+
+func (lease *Lease) Renew() error {
+	renewed, err := AcquireLease(lease.leasePath, lease.Owner, lease.ttl)
+	if err != nil {
+		return err
+	}
+	lease.Expires = renewed.Expires
+	return nil
+}
+
+// KeepAlive 는 ctx 가 끝날 때까지 ttl 의 1/3 마다 갱신한다. 갱신에 실패하면 lost 를 부르고 멈춘다.
+func (lease *Lease) KeepAlive(ctx context.Context, lost func(error)) {
+	ticker := time.NewTicker(lease.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := lease.Renew(); err != nil {
+				lost(err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package queue
+
+import (
+	"context"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestAcquireLease(t *testing.T) {
+	leasePath := path.Join(testBase, "lease_test.json")
+	ttl := time.Millisecond * 300
+
+	a, err := AcquireLease(leasePath, "a", ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if held, err := AcquireLease(leasePath, "b", ttl); err != ErrLeaseHeld || held.Owner != "a" {
+		t.Errorf("AcquireLease() while held = %v, %v", held, err)
+	}
+	if err := a.Renew(); err != nil {
+		t.Errorf("Renew() = %v", err)
+	}
+
+	// 갱신하는 동안에는 넘어가지 않는다.
+	ctx, cancel := context.WithCancel(context.Background())
+	go a.KeepAlive(ctx, func(err error) { t.Errorf("lost - %v", err) })
+	time.Sleep(ttl * 2)
+	if _, err := AcquireLease(leasePath, "b", ttl); err != ErrLeaseHeld {
+		t.Errorf("AcquireLease() while renewing = %v", err)
+	}
+	cancel()
+
+	// 만료되면 다른 주인이 가져가고, 이전 주인은 갱신할 수 없다.
+	time.Sleep(ttl + time.Millisecond*50)
+	if _, err := AcquireLease(leasePath, "b", ttl); err != nil {
+		t.Errorf("AcquireLease() after expired = %v", err)
+	}
+	if err := a.Renew(); err != ErrLeaseHeld {
+		t.Errorf("Renew() after taken over = %v", err)
+	}
+
+	// 놓으면 바로 가져갈 수 있다.
+	if err := ReleaseLease(leasePath, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AcquireLease(leasePath, "a", ttl); err != nil {
+		t.Errorf("AcquireLease() after released = %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/PaesslerAG/jsonpath"
+	"time"
+)
+
+// NotBeforeOf 는 Pipeline.NotBefore 로 Item 을 보내도 되는 시각을 꺼낸다.
+// RFC3339 문자열이나 유닉스 초를 받는다. NotBefore 가 없거나 Item 에 그 값이 없으면 zero 이다.
+func (pipe *Pipeline) NotBeforeOf(o interface{}) (time.Time, error) {
+	if pipe.NotBefore == "" {
+		return time.Time{}, nil
+	}
+	v, err := jsonpath.Get(pipe.NotBefore, o)
+	if err != nil {
+		return time.Time{}, nil
+	}
+	switch t := v.(type) {
+	case nil:
+		return time.Time{}, nil
+	case string:
+		parsed, err := time.Parse(time.RFC3339, t)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("NotBefore %v - %w", pipe.NotBefore, err)
+		}
+		return parsed, nil
+	case float64:
+		sec := int64(t)
+		return time.Unix(sec, int64((t-float64(sec))*float64(time.Second))), nil
+	}
+	return time.Time{}, fmt.Errorf("NotBefore %v is not a time - %v", pipe.NotBefore, v)
+}
+
+// takeDue 는 때가 된 Item 만 n 개까지 모은다. 때가 되지 않은 것은 Defer 로 미루고 n 에 세지 않는다.
+// 읽을 수 없는 시각은 미루지 않고 내어준다. proc 이 보내지 않고 dead letter 로 남긴다.
+func (pipe *Pipeline) takeDue(backend QueueBackend, n int, now time.Time) ([]*Item, error) {
+	ready := make([]*Item, 0)
+	for len(ready) < n {
+		taken, err := backend.Take(n - len(ready))
+		if err != nil || len(taken) == 0 {
+			return ready, err
+		}
+		for _, item := range taken {
+			var o interface{}
+			var notBefore time.Time
+			err := json.Unmarshal(item.Data, &o)
+			if err == nil {
+				notBefore, err = pipe.NotBeforeOf(o)
+			}
+			if err != nil || !notBefore.After(now) {
+				ready = append(ready, item)
+				continue
+			}
+			// 미루지 못한 것은 Ack 하지 않은 채로 두어 다음 실행에서 다시 본다.
+			if err := item.Defer(notBefore); err != nil {
+				return ready, err
+			}
+		}
+	}
+	return ready, nil
+}
@@ -0,0 +1,76 @@
+package queue
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPipeline_NotBeforeOf(t *testing.T) {
+	pipe := &Pipeline{NotBefore: "$.at"}
+	tests := []struct {
+		o       interface{}
+		want    time.Time
+		wantErr bool
+	}{
+		{o: map[string]interface{}{"at": "2022-10-01T09:00:00+09:00"}, want: time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)},
+		{o: map[string]interface{}{"at": float64(1664582400)}, want: time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)},
+		{o: map[string]interface{}{"at": nil}},
+		{o: map[string]interface{}{}},
+		{o: map[string]interface{}{"at": "tomorrow"}, wantErr: true},
+		{o: map[string]interface{}{"at": true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := pipe.NotBeforeOf(tt.o)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("NotBeforeOf(%v) = %v, %v, want %v", tt.o, got, err, tt.want)
+		}
+	}
+}
+
+func TestPipeline_TakeNotBefore(t *testing.T) {
+	queuePath := path.Join(testBase, "notbefore_test1")
+	pipe := &Pipeline{queuePath: queuePath, NotBefore: "$.at"}
+	defer pipe.Close()
+
+	// 2 와 4 는 미뤄지고 그 자리를 뒤의 것이 채운다.
+	taken := pipe.TakeN(3)
+	if got := itemData(taken, false); !reflect.DeepEqual(got, [][]byte{
+		[]byte(`{"id":"1","at":"2000-01-01T00:00:00Z"}`),
+		[]byte(`{"id":"3"}`),
+		[]byte(`{"id":"5","at":"soon"}`),
+	}) {
+		t.Errorf("TakeN() = %s", got)
+	}
+	for _, item := range taken {
+		_ = item.Ack()
+	}
+	next := pipe.TakeN(3)
+	if got := itemData(next, false); !reflect.DeepEqual(got, [][]byte{[]byte(`{"id":"6","at":946684800}`)}) {
+		t.Errorf("TakeN() = %s", got)
+	}
+	for _, item := range next {
+		_ = item.Ack()
+	}
+
+	dirs, _ := os.ReadDir(queuePath)
+	var deferred []string
+	for _, d := range dirs {
+		if strings.HasPrefix(d.Name(), "retry-") && IsQueueFileName(d.Name()) {
+			b, _ := os.ReadFile(path.Join(queuePath, d.Name()))
+			deferred = append(deferred, string(b))
+		}
+	}
+	if len(deferred) != 2 {
+		t.Fatalf("deferred = %v", deferred)
+	}
+	// 미룬 것은 Attempt 를 올리지 않는다.
+	for _, d := range deferred {
+		if !strings.Contains(d, `"Attempt":1`) {
+			t.Errorf("deferred = %v", d)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package queue
+
+import "path"
+
+// OverlapPolicy 는 이전 실행이 아직 안끝났을 때 새 실행을 어떻게 할지 정한다.
+type OverlapPolicy string
+
+const OverlapSkip = OverlapPolicy("SKIP")
+const OverlapQueue = OverlapPolicy("QUEUE")
+const OverlapCancel = OverlapPolicy("CANCEL")
+
+// RunLockName 은 파이프라인 디렉토리에서 실행중임을 표시하는 잠금파일이다.
+const RunLockName = "_run.lock"
+
+func (pipe *Pipeline) LockPath() string {
+	return path.Join(pipe.queuePath, RunLockName)
+}
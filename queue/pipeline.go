@@ -1,14 +1,19 @@
 package queue
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/PaesslerAG/gval"
 	"github.com/PaesslerAG/jsonpath"
 	"github.com/robfig/cron"
+	"github.com/santhosh-tekuri/jsonschema/v5"
 	logrus "github.com/sirupsen/logrus"
 	"io/ioutil"
 	"lazyboy/tmpl"
 	"path"
+	"sync"
 	"text/template"
 	"time"
 )
@@ -21,11 +26,30 @@ type Pipeline struct {
 	Workers       int
 	ReqTmplName   string
 	ResTmplName   string
+	SchemaName    string // config.json 옆의 JSON Schema 파일. 있으면 보내기 전에 Item 을 검사한다.
+	Filter        string // 참이 아닌 Item 은 보내지 않고 skipped 로 남긴다.
+	Chain         ChainPolicy
 	ResBodyType   BodyType
 	OutputPath    string
+	Retry         RetryPolicy
+	WaitForDone   bool // true 면 <이름>.done 이 생긴 큐파일만 읽는다.
+	Overlap       OverlapPolicy
+	BackendType   BackendType `json:"Backend"`
+	Csv           CsvOptions  // .csv/.tsv 큐파일을 읽는 방법
+	Xlsx          XlsxOptions // .xlsx 큐파일을 읽는 방법
+	Archive       ArchivePolicy
+	Dedup         DedupPolicy
+	NotBefore     string // 이 JSONPath 의 시각이 되기 전에는 보내지 않는다.
+	Priority      PriorityPolicy
 	reqTmplString string
 	resTmplString string
 	queuePath     string
+	backend       QueueBackend
+	dedup         *DedupStore
+	schema        *jsonschema.Schema
+	filter        gval.Evaluable
+	chain         *Pipeline // Chain 으로 넘길 뒤 파이프라인
+	chainMu       sync.Mutex
 }
 
 func (pipe *Pipeline) OutputAbsPath() string {
@@ -77,6 +101,19 @@ func NewPipeline(basePath string, jsonStr []byte) (*Pipeline, error) {
 		pipe.resTmplString = string(b)
 	}
 
+	err = pipe.loadSchema()
+	if err != nil {
+		return nil, err
+	}
+	err = pipe.loadFilter()
+	if err != nil {
+		return nil, err
+	}
+	err = pipe.checkChain()
+	if err != nil {
+		return nil, err
+	}
+
 	if pipe.OutputPath == "" {
 		return nil, errors.New("OutputPath is required")
 	}
@@ -85,6 +122,22 @@ func NewPipeline(basePath string, jsonStr []byte) (*Pipeline, error) {
 		return nil, errors.New("UniqueKey is required")
 	}
 
+	err = pipe.Csv.validate()
+	if err != nil {
+		return nil, err
+	}
+	err = pipe.Xlsx.validate()
+	if err != nil {
+		return nil, err
+	}
+	err = pipe.Priority.validate()
+	if err != nil {
+		return nil, err
+	}
+	if len(pipe.Priority.Lanes) > 0 && pipe.BackendType != "" && pipe.BackendType != BackendTypeFile {
+		return nil, fmt.Errorf("Priority.Lanes is not supported by %v backend", pipe.BackendType)
+	}
+
 	return &pipe, nil
 }
 func (pipe *Pipeline) IsActive(t time.Time) bool {
@@ -117,23 +170,55 @@ func (pipe *Pipeline) ResTmpl() (*template.Template, error) {
 func (pipe *Pipeline) WantToTake() int {
 	return pipe.TakePerTick
 }
-func (pipe *Pipeline) Take() [][]byte {
-	var gTaken = make([][]byte, 0)
-	var want = pipe.WantToTake()
-	for want > 0 {
-		queue, err := OfferFileQueue(pipe.queuePath)
-		if err != nil {
-			logrus.WithFields(logrus.Fields{"ctx": "queue/Pipeline.Take", "path": pipe.queuePath}).Debug("no more data.", err)
-			break
-		}
 
-		taken := queue.Take(want)
-		if taken != nil {
-			want -= len(taken)
-			for _, b := range taken {
-				gTaken = append(gTaken, b)
-			}
-		}
+// Take 는 TakePerTick 만큼 예약해서 돌려준다. 돌려받은 Item 은 결과를 기록한 뒤 Ack 해야 한다.
+func (pipe *Pipeline) Take() []*Item {
+	return pipe.TakeN(pipe.WantToTake())
+}
+
+// TakeN 은 TakePerTick 대신 n 만큼 예약한다.
+func (pipe *Pipeline) TakeN(n int) []*Item {
+	logger := logrus.WithFields(logrus.Fields{"ctx": "queue/Pipeline.Take", "path": pipe.queuePath})
+	backend, err := pipe.Backend()
+	if err != nil {
+		logger.Warn("Backend failed.", err)
+		return make([]*Item, 0)
+	}
+	var taken []*Item
+	if pipe.NotBefore == "" {
+		taken, err = backend.Take(n)
+	} else {
+		taken, err = pipe.takeDue(backend, n, time.Now())
+	}
+	if err != nil {
+		logger.Debug("no more data.", err)
+	}
+	return taken
+}
+
+// Offer 는 UniqueKey 가 나오고 Schema 에 맞는지 확인한 뒤 한 줄로 줄여서 파이프라인의 큐에 넣는다.
+func (pipe *Pipeline) Offer(data []byte) error {
+	var o interface{}
+	err := json.Unmarshal(data, &o)
+	if err != nil {
+		return err
+	}
+	_, err = pipe.GetUniqueKey(o)
+	if err != nil {
+		return fmt.Errorf("UniqueKey %v - %w", pipe.UniqueKey, err)
+	}
+	err = pipe.Validate(o)
+	if err != nil {
+		return err
+	}
+	var compacted bytes.Buffer
+	err = json.Compact(&compacted, data)
+	if err != nil {
+		return err
+	}
+	backend, err := pipe.Backend()
+	if err != nil {
+		return err
 	}
-	return gTaken
+	return backend.Offer(compacted.Bytes())
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	log "github.com/sirupsen/logrus"
 	"lazyboy/tmpl"
+	"os"
 	"path"
 	"reflect"
 	"testing"
@@ -94,12 +95,82 @@ func TestQueue_Take(t *testing.T) {
 			if q == nil {
 				t.Errorf("Pipeline failed construction")
 			}
-			if got := q.Take(); !reflect.DeepEqual(got, tt.want) {
+			if got := itemData(q.Take(), true); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Take() = \n%v, \nwant \n%v", got, tt.want)
 			}
 		})
 	}
 }
+func TestPipeline_TakeWithoutAck(t *testing.T) {
+	configPath := path.Join(testBase, "pipeline_take_test2", "queue1", "_config.json")
+
+	// Ack 하지 않으면 다음 실행에서 다시 받는다.
+	first := newQueue(configPath).Take()
+	if got := itemData(first, false); !reflect.DeepEqual(got, [][]byte{[]byte("0"), []byte("1"), []byte("2")}) {
+		t.Errorf("Take() = %v", got)
+	}
+	pipe := newQueue(configPath)
+	second := pipe.Take()
+	if got := itemData(second, false); !reflect.DeepEqual(got, [][]byte{[]byte("0"), []byte("1"), []byte("2")}) {
+		t.Errorf("Take() redelivery = %v", got)
+	}
+
+	// 같은 실행 안에서는 예약된 것 다음부터 받는다.
+	if got := itemData(pipe.Take(), false); !reflect.DeepEqual(got, [][]byte{[]byte("3"), []byte("4")}) {
+		t.Errorf("Take() second batch = %v", got)
+	}
+
+	// 가운데만 Ack 되면 앞의 것이 Ack 될때까지 Offset 은 움직이지 않는다.
+	_ = second[1].Ack()
+	if got := itemData(newQueue(configPath).Take(), false); !reflect.DeepEqual(got, [][]byte{[]byte("0"), []byte("1"), []byte("2")}) {
+		t.Errorf("Take() after partial ack = %v", got)
+	}
+	_ = second[0].Ack()
+	if got := itemData(newQueue(configPath).Take(), false); !reflect.DeepEqual(got, [][]byte{[]byte("2"), []byte("3"), []byte("4")}) {
+		t.Errorf("Take() after ack = %v", got)
+	}
+}
+
+func TestPipeline_TakeWaitForDone(t *testing.T) {
+	configPath := path.Join(testBase, "pipeline_take_test3", "_config.json")
+	if got := newQueue(configPath).Take(); len(got) != 0 {
+		t.Errorf("Take() before done = %s", itemData(got, false))
+	}
+	_ = os.WriteFile(path.Join(testBase, "pipeline_take_test3", "data.jsonl.done"), nil, 0644)
+	if got := itemData(newQueue(configPath).Take(), true); !reflect.DeepEqual(got, [][]byte{[]byte("0"), []byte("1")}) {
+		t.Errorf("Take() after done = %s", got)
+	}
+}
+
+func TestPipeline_Offer(t *testing.T) {
+	pipe := newPipeline(path.Join(testBase, "pipeline_offer_test1", "_config.json"))
+	defer pipe.Close()
+	if err := pipe.Offer([]byte("{\n  \"uuid\": \"1\"\n}")); err != nil {
+		t.Fatal(err)
+	}
+	if err := pipe.Offer([]byte(`{"id":"2"}`)); err == nil {
+		t.Errorf("Offer() without UniqueKey")
+	}
+	if err := pipe.Offer([]byte(`{"uuid":`)); err == nil {
+		t.Errorf("Offer() invalid json")
+	}
+	// 직접 쓴 큐파일은 WaitForDone 이어도 .done 을 기다리지 않는다.
+	if got := itemData(pipe.Take(), true); !reflect.DeepEqual(got, [][]byte{[]byte(`{"uuid":"1"}`)}) {
+		t.Errorf("Take() = %s", got)
+	}
+}
+
+func itemData(items []*Item, ack bool) [][]byte {
+	var data = make([][]byte, 0)
+	for _, item := range items {
+		data = append(data, item.Data)
+		if ack {
+			_ = item.Ack()
+		}
+	}
+	return data
+}
+
 func newPipeline(configPath string) *Pipeline {
 	pipe, err := NewPipelineFromConfigPath(configPath)
 	if err != nil {
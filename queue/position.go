@@ -0,0 +1,159 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+var ErrNoSuchPosition = errors.New("no such position")
+
+// QueuePosition 은 큐파일 하나를 어디까지 읽었는지 보여준다.
+type QueuePosition struct {
+	Name  string
+	Pos   FileQueuePos
+	Done  int64  // Offset 앞의 건수
+	Rest  int64  // Offset 뒤의 건수
+	Error string // pos 나 큐파일을 읽지 못한 이유
+}
+
+// QueuePositions 는 파이프라인 디렉토리의 큐파일마다 읽은 위치와 건수를 센다.
+// 다 읽은 것과 LastError 로 멈춘 것도 보여준다. 읽기만 하므로 잠금 없이 불러도 된다.
+// 읽지 못한 큐파일은 Error 만 채우고 다음 큐파일로 넘어간다.
+func (pipe *Pipeline) QueuePositions() ([]QueuePosition, error) {
+	dirs, err := os.ReadDir(pipe.queuePath)
+	if err != nil {
+		return nil, err
+	}
+	var positions []QueuePosition
+	for _, d := range dirs {
+		if d.IsDir() || !IsQueueFileName(d.Name()) {
+			continue
+		}
+		position := QueuePosition{Name: d.Name()}
+		fq, err := pipe.peekFileQueue(d.Name())
+		if err == nil {
+			position.Pos = fq.Pos
+			position.Done, position.Rest, err = countItems(fq)
+		}
+		if err != nil {
+			position.Error = err.Error()
+		}
+		positions = append(positions, position)
+	}
+	return positions, nil
+}
+
+// peekFileQueue 는 NewFileQueue 와 달리 pos 파일을 만들거나 확인하지 않고 읽기만 한다.
+func (pipe *Pipeline) peekFileQueue(name string) (*FileQueue, error) {
+	fq := &FileQueue{QueuePath: pipe.queuePath, FileQueueName: name, csv: pipe.Csv, xlsx: pipe.Xlsx}
+	posData, err := os.ReadFile(path.Join(pipe.queuePath, name+".pos"))
+	if os.IsNotExist(err) {
+		return fq, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(posData, &fq.Pos)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pos file - %v", err)
+	}
+	return fq, nil
+}
+
+// RewindLine 은 name 의 line 번째 줄부터 다시 읽게 한다. 1 이 처음이다.
+// 빈 줄도 센다. .csv/.tsv 는 머리줄을 빼고 레코드 단위로, .xlsx 는 행 단위로 센다.
+func (pipe *Pipeline) RewindLine(name string, line int64) (int64, error) {
+	return pipe.rewind(name, func(n, offset int64, data []byte) bool {
+		return data != nil && n == line
+	})
+}
+
+// RewindOffset 은 name 을 offset 부터 다시 읽게 한다. offset 은 줄의 시작이어야 한다.
+// 압축파일은 푼 뒤의 위치, .xlsx 는 행 번호이다.
+func (pipe *Pipeline) RewindOffset(name string, offset int64) (int64, error) {
+	return pipe.rewind(name, func(n, start int64, data []byte) bool {
+		return start == offset
+	})
+}
+
+// RewindKey 는 name 에서 UniqueKey 가 key 인 첫 Item 부터 다시 읽게 한다.
+func (pipe *Pipeline) RewindKey(name string, key string) (int64, error) {
+	return pipe.rewind(name, func(n, offset int64, data []byte) bool {
+		var o interface{}
+		if data == nil || json.Unmarshal(data, &o) != nil {
+			return false
+		}
+		uniqueKey, err := pipe.GetUniqueKey(o)
+		return err == nil && fmt.Sprint(uniqueKey) == key
+	})
+}
+
+// rewind 는 처음부터 읽으면서 match 되는 줄의 시작으로 Pos.Offset 을 옮긴다. 앞으로 옮길 수도 있다.
+// match 는 줄 번호, 줄의 시작, 내용을 받는다. 파일 끝에서는 내용이 nil 이다.
+// 데몬과 같이 돌 때는 파이프라인 잠금 안에서 불러야 한다.
+func (pipe *Pipeline) rewind(name string, match func(n, offset int64, data []byte) bool) (int64, error) {
+	fq, err := pipe.fileQueue(name)
+	if err != nil {
+		return 0, err
+	}
+	rd, err := fq.openReader(0)
+	if err != nil {
+		return 0, err
+	}
+	defer rd.Close()
+	var n, start int64
+	for {
+		data, next, err := rd.Next()
+		err = ignoreRowError(err)
+		if err == io.EOF {
+			if match(n+1, start, nil) {
+				return start, fq.movePos(start)
+			}
+			return 0, fmt.Errorf("%w in %v", ErrNoSuchPosition, name)
+		}
+		if err != nil {
+			return 0, err
+		}
+		n++
+		if data == nil {
+			data = []byte{}
+		}
+		if match(n, start, data) {
+			return start, fq.movePos(start)
+		}
+		start = next
+	}
+}
+
+// ClearLastError 는 LastError 를 지워서 name 을 다시 읽게 한다.
+// 남겨둔 크기와 hash 는 그대로 두므로 그 사이에 바뀐 큐파일은 다음 실행에서 격리된다.
+func (pipe *Pipeline) ClearLastError(name string) error {
+	fq, err := pipe.fileQueue(name)
+	if err != nil {
+		return err
+	}
+	fq.Pos.LastError = ""
+	return fq.writePos()
+}
+
+func (fq *FileQueue) movePos(offset int64) error {
+	fq.Pos.Offset = offset
+	return fq.SyncPos()
+}
+
+// fileQueue 는 파이프라인 디렉토리에 있는 큐파일 name 의 pos 를 읽는다.
+// 고치려고 여는 것이므로 NewFileQueue 처럼 pos 를 확인해서 격리하지 않는다.
+func (pipe *Pipeline) fileQueue(name string) (*FileQueue, error) {
+	if strings.ContainsAny(name, `/\`) || !IsQueueFileName(name) {
+		return nil, fmt.Errorf("%v is not a queue file", name)
+	}
+	if _, err := os.Stat(path.Join(pipe.queuePath, name)); err != nil {
+		return nil, err
+	}
+	return pipe.peekFileQueue(name)
+}
@@ -0,0 +1,130 @@
+package queue
+
+import (
+	"errors"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestPipeline_Rewind(t *testing.T) {
+	pipe := &Pipeline{queuePath: path.Join(testBase, "position_test1"), UniqueKey: "$.id"}
+	tests := []struct {
+		name    string
+		rewind  func() (int64, error)
+		want    int64
+		wantErr error
+	}{
+		{name: "line 2", rewind: func() (int64, error) { return pipe.RewindLine("data.jsonl", 2) }, want: 11},
+		{name: "blank line", rewind: func() (int64, error) { return pipe.RewindLine("data.jsonl", 3) }, want: 22},
+		{name: "line 5", rewind: func() (int64, error) { return pipe.RewindLine("data.jsonl", 5) }, wantErr: ErrNoSuchPosition},
+		{name: "offset", rewind: func() (int64, error) { return pipe.RewindOffset("data.jsonl", 23) }, want: 23},
+		{name: "offset at end", rewind: func() (int64, error) { return pipe.RewindOffset("data.jsonl", 34) }, want: 34},
+		{name: "offset in line", rewind: func() (int64, error) { return pipe.RewindOffset("data.jsonl", 5) }, wantErr: ErrNoSuchPosition},
+		{name: "key", rewind: func() (int64, error) { return pipe.RewindKey("data.jsonl", "c") }, want: 23},
+		{name: "first key", rewind: func() (int64, error) { return pipe.RewindKey("data.jsonl", "a") }, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.rewind()
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Fatalf("rewind = %v, %v, want %v, %v", got, err, tt.want, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			fq, err := NewFileQueue(pipe.queuePath, "data.jsonl")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fq.Pos.Offset != tt.want {
+				t.Errorf("Pos.Offset = %v, want %v", fq.Pos.Offset, tt.want)
+			}
+		})
+	}
+
+	// 앞에서 Rewind 한 위치부터 한 건만 남아있다.
+	fq, _ := NewFileQueue(pipe.queuePath, "data.jsonl")
+	fq.Pos.LastError = "broken"
+	_ = fq.SyncPos()
+	positions, err := pipe.QueuePositions()
+	if err != nil || len(positions) != 1 || positions[0].Done != 0 || positions[0].Rest != 3 || positions[0].Pos.LastError != "broken" {
+		t.Errorf("QueuePositions() = %+v, %v", positions, err)
+	}
+	if err := pipe.ClearLastError("data.jsonl"); err != nil {
+		t.Fatal(err)
+	}
+	fq, _ = NewFileQueue(pipe.queuePath, "data.jsonl")
+	if fq.Pos.LastError != "" {
+		t.Errorf("LastError = %v", fq.Pos.LastError)
+	}
+	if _, err := pipe.RewindLine("../data.jsonl", 1); err == nil {
+		t.Errorf("RewindLine() outside the pipeline")
+	}
+}
+
+func TestPipeline_QueuePositionsReadOnly(t *testing.T) {
+	queuePath := path.Join(testBase, "position_test2")
+	_ = os.MkdirAll(queuePath, 0755)
+	_ = os.WriteFile(path.Join(queuePath, "fresh.jsonl"), []byte("{\"id\":\"a\"}\n"), 0644)
+	_ = os.WriteFile(path.Join(queuePath, "broken.jsonl"), []byte("{\"id\":\"b\"}\n"), 0644)
+	_ = os.WriteFile(path.Join(queuePath, "broken.jsonl.pos"), []byte("{"), 0644)
+	pipe := &Pipeline{queuePath: queuePath, UniqueKey: "$.id"}
+
+	// 깨진 pos 는 Error 로만 보여주고 나머지는 계속 센다.
+	positions, err := pipe.QueuePositions()
+	if err != nil || len(positions) != 2 {
+		t.Fatalf("QueuePositions() = %+v, %v", positions, err)
+	}
+	if positions[0].Name != "broken.jsonl" || positions[0].Error == "" {
+		t.Errorf("positions[0] = %+v", positions[0])
+	}
+	if positions[1].Name != "fresh.jsonl" || positions[1].Error != "" || positions[1].Rest != 1 {
+		t.Errorf("positions[1] = %+v", positions[1])
+	}
+
+	// pos 를 만들지도 않고 깨진 큐파일을 옮기지도 않는다.
+	if _, err := os.Stat(path.Join(queuePath, "fresh.jsonl.pos")); !os.IsNotExist(err) {
+		t.Errorf("fresh.jsonl.pos is created - %v", err)
+	}
+	if _, err := os.Stat(path.Join(queuePath, "broken.jsonl")); err != nil {
+		t.Errorf("broken.jsonl is moved - %v", err)
+	}
+}
+
+func TestPipeline_RewindChangedFile(t *testing.T) {
+	queuePath := path.Join(testBase, "position_test3")
+	_ = os.MkdirAll(queuePath, 0755)
+	fqPath := path.Join(queuePath, "data.jsonl")
+	_ = os.WriteFile(fqPath, []byte("{\"id\":\"a\"}\n{\"id\":\"b\"}\n"), 0644)
+	fq, err := NewFileQueue(queuePath, "data.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = fq.movePos(11)
+	_ = os.WriteFile(fqPath, []byte("{\"id\":\"x\"}\n{\"id\":\"y\"}\n"), 0644)
+	pipe := &Pipeline{queuePath: queuePath, UniqueKey: "$.id"}
+
+	// 바뀐 큐파일도 격리하지 않고 pos 만 고친다.
+	if err := pipe.ClearLastError("data.jsonl"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fqPath); err != nil {
+		t.Fatalf("data.jsonl is moved by clear - %v", err)
+	}
+	if _, err := pipe.RewindKey("data.jsonl", "y"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fqPath); err != nil {
+		t.Fatalf("data.jsonl is moved by rewind - %v", err)
+	}
+
+	// 되돌린 위치는 지금의 파일로 남아서 다음에 열어도 격리되지 않는다.
+	fq, err = NewFileQueue(queuePath, "data.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items := fq.Reserve(10); len(items) != 1 || string(items[0].Data) != `{"id":"y"}` {
+		t.Errorf("Reserve() after rewind = %v items", len(items))
+	}
+}
@@ -0,0 +1,282 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProducerLockName 은 파이프라인 디렉토리에 덧붙이는 생산자들이 같이 잡는 잠금파일이다.
+const ProducerLockName = "_produce.lock"
+
+// DefaultProducerPrefix 는 ProducerOptions.Prefix 가 비어있을 때 쓰는 큐파일 이름 앞부분이다.
+const DefaultProducerPrefix = "produce-"
+
+// producerSeqFormat 은 이름순이 곧 쓴 순서가 되도록 자리수를 맞춘다.
+const producerSeqFormat = "%010d"
+
+type ProducerOptions struct {
+	Prefix  string        // 큐파일 이름은 <Prefix><순번>.jsonl 이다.
+	MaxSize int64         // 이 크기를 넘으면 다음 순번으로 넘어간다. 0 이면 크기로 넘기지 않는다.
+	MaxAge  time.Duration // 이 Producer 가 파일에 처음 쓴 뒤 이만큼 지나면 다음 순번으로 넘어간다. 0 이면 시간으로 넘기지 않는다.
+	Sync    bool          // true 면 Append 마다 fsync 한다.
+}
+
+// Producer 는 파이프라인 디렉토리의 큐파일에 한 줄씩 덧붙인다.
+// 다른 생산자와는 _produce.lock 으로, FileQueue 와는 줄바꿈까지 한번에 쓰는 것으로 맞춘다.
+// 다음 순번으로 넘어갈 때 이전 파일에 <이름>.done 을 남기므로 WaitForDone 파이프라인도 읽을 수 있다.
+type Producer struct {
+	QueuePath string
+	Options   ProducerOptions
+	file      *os.File
+	seq       int
+	openedAt  time.Time
+	mu        sync.Mutex
+}
+
+// producerLocks 는 같은 프로세스의 Producer 끼리 flock 을 기다리며 도는 일이 없도록 먼저 막는다.
+var producerLocks = struct {
+	sync.Mutex
+	m map[string]*sync.Mutex
+}{m: map[string]*sync.Mutex{}}
+
+// lockProducers 는 queuePath 에 덧붙이는 생산자들을 막는다. 큐파일을 옮기는 쪽도 이것을 잡아야 한다.
+func lockProducers(queuePath string) (func(), error) {
+	lockPath := path.Join(queuePath, ProducerLockName)
+	producerLocks.Lock()
+	mu, ok := producerLocks.m[lockPath]
+	if !ok {
+		mu = &sync.Mutex{}
+		producerLocks.m[lockPath] = mu
+	}
+	producerLocks.Unlock()
+
+	mu.Lock()
+	lock := NewFileLock(lockPath)
+	err := lock.Lock(context.Background())
+	if err != nil {
+		mu.Unlock()
+		return nil, err
+	}
+	return func() {
+		lock.Unlock()
+		mu.Unlock()
+	}, nil
+}
+
+func NewProducer(queuePath string, options ProducerOptions) (*Producer, error) {
+	stat, err := os.Stat(queuePath)
+	if err != nil {
+		return nil, err
+	}
+	if !stat.IsDir() {
+		return nil, fmt.Errorf("%v is not a directory", queuePath)
+	}
+	if options.Prefix == "" {
+		options.Prefix = DefaultProducerPrefix
+	}
+	return &Producer{QueuePath: queuePath, Options: options}, nil
+}
+
+// Append 는 JSON 하나를 한 줄로 줄여서 덧붙인다.
+func (p *Producer) Append(data []byte) error {
+	var compacted bytes.Buffer
+	err := json.Compact(&compacted, data)
+	if err != nil {
+		return err
+	}
+	return p.appendLine(compacted.Bytes())
+}
+
+// AppendObject 는 v 를 JSON 으로 바꿔서 덧붙인다.
+func (p *Producer) AppendObject(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return p.appendLine(data)
+}
+
+func (p *Producer) appendLine(line []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	unlock, err := lockProducers(p.QueuePath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = p.prepare()
+	if err != nil {
+		return err
+	}
+	_, err = p.file.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+	if p.Options.Sync {
+		return p.file.Sync()
+	}
+	return nil
+}
+
+// Sync 는 지금까지 덧붙인 것을 디스크에 내린다.
+func (p *Producer) Sync() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.file == nil {
+		return nil
+	}
+	return p.file.Sync()
+}
+
+// Close 는 파일만 닫는다. 다른 생산자가 이어서 쓸 수 있으므로 .done 은 남기지 않는다.
+func (p *Producer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.file == nil {
+		return nil
+	}
+	err := p.file.Close()
+	p.file = nil
+	return err
+}
+
+// FileName 은 지금 쓰고 있는 큐파일 이름이다.
+func (p *Producer) FileName() string {
+	return p.name(p.seq)
+}
+
+func (p *Producer) name(seq int) string {
+	return p.Options.Prefix + fmt.Sprintf(producerSeqFormat, seq) + suffixJsonl
+}
+
+// prepare 는 잠금 안에서 쓸 파일을 정한다.
+// 다른 생산자가 이미 다음 순번으로 넘어갔으면 그 파일을 따라가고, 지금 파일이 찼으면 다음 순번을 만든다.
+func (p *Producer) prepare() error {
+	// 다 읽혀서 archive/ 로 옮겨진 파일에는 더 쓰지 않는다.
+	if p.file != nil && !p.present() {
+		p.file.Close()
+		p.file = nil
+	}
+	last, err := p.lastSeq()
+	if err != nil {
+		return err
+	}
+	if p.file != nil && last == p.seq && !p.full() {
+		return nil
+	}
+	if last == 0 {
+		last = 1
+	}
+	if last != p.seq || p.file == nil {
+		err = p.open(last)
+		if err != nil {
+			return err
+		}
+		if !p.full() {
+			return nil
+		}
+	}
+	err = p.seal()
+	if err != nil {
+		return err
+	}
+	return p.open(p.seq + 1)
+}
+
+// present 는 열어둔 파일이 아직 그 이름으로 디렉토리에 있는지 본다.
+func (p *Producer) present() bool {
+	opened, err := p.file.Stat()
+	if err != nil {
+		return false
+	}
+	named, err := os.Stat(path.Join(p.QueuePath, p.name(p.seq)))
+	if err != nil {
+		return false
+	}
+	return os.SameFile(opened, named)
+}
+
+// full 은 지금 파일이 다음 순번으로 넘어갈 때가 되었는지 본다.
+func (p *Producer) full() bool {
+	if _, err := os.Stat(path.Join(p.QueuePath, p.name(p.seq)+".done")); err == nil {
+		return true
+	}
+	if p.Options.MaxAge > 0 && time.Since(p.openedAt) >= p.Options.MaxAge {
+		return true
+	}
+	if p.Options.MaxSize > 0 {
+		stat, err := p.file.Stat()
+		if err == nil && stat.Size() >= p.Options.MaxSize {
+			return true
+		}
+	}
+	return false
+}
+
+// seal 은 지금 파일에 .done 을 남긴다. 그 뒤로는 아무도 덧붙이지 않는다.
+func (p *Producer) seal() error {
+	err := p.file.Sync()
+	if err != nil {
+		return err
+	}
+	return writeFileSync(path.Join(p.QueuePath, p.name(p.seq)+".done"), nil)
+}
+
+func (p *Producer) open(seq int) error {
+	if p.file != nil {
+		p.file.Close()
+		p.file = nil
+	}
+	file, err := os.OpenFile(path.Join(p.QueuePath, p.name(seq)), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	err = syncDir(p.QueuePath)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	p.file, p.seq, p.openedAt = file, seq, time.Now()
+	return nil
+}
+
+// lastSeq 는 디렉토리에서 가장 큰 순번이다. 없으면 0 이다.
+// archive/ 로 옮겨진 순번은 다시 쓰지 않도록 다음 순번을 돌려준다.
+func (p *Producer) lastSeq() (int, error) {
+	var last int
+	for _, dir := range []string{p.QueuePath, path.Join(p.QueuePath, ArchiveDir)} {
+		dirs, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		for _, d := range dirs {
+			name := strings.TrimSuffix(d.Name(), ".gz")
+			if d.IsDir() || !strings.HasPrefix(name, p.Options.Prefix) || !strings.HasSuffix(name, suffixJsonl) {
+				continue
+			}
+			seq, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, p.Options.Prefix), suffixJsonl))
+			if err != nil {
+				continue
+			}
+			if dir != p.QueuePath {
+				seq++
+			}
+			if seq > last {
+				last = seq
+			}
+		}
+	}
+	return last, nil
+}
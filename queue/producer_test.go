@@ -0,0 +1,70 @@
+package queue
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProducer(t *testing.T) {
+	queuePath := path.Join(testBase, "producer_test1")
+	_ = os.MkdirAll(queuePath, 0755)
+
+	p1, err := NewProducer(queuePath, ProducerOptions{MaxSize: 26, Sync: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p1.Close()
+	p2, _ := NewProducer(queuePath, ProducerOptions{MaxSize: 26})
+	defer p2.Close()
+
+	// 두 생산자가 같은 파일에 번갈아 쓰다가 차면 같이 다음 순번으로 넘어간다.
+	_ = p1.Append([]byte("{\n \"uuid\": \"1\"\n}"))
+	_ = p2.AppendObject(map[string]string{"uuid": "2"})
+	_ = p1.AppendObject(map[string]string{"uuid": "3"})
+	_ = p2.AppendObject(map[string]string{"uuid": "4"})
+	if err := p1.Append([]byte(`{"uuid":`)); err == nil {
+		t.Errorf("Append() invalid json")
+	}
+	if p1.FileName() != "produce-0000000002.jsonl" || p2.FileName() != p1.FileName() {
+		t.Errorf("FileName() = %v, %v", p1.FileName(), p2.FileName())
+	}
+	want := map[string]string{
+		"produce-0000000001.jsonl": "{\"uuid\":\"1\"}\n{\"uuid\":\"2\"}\n",
+		"produce-0000000002.jsonl": "{\"uuid\":\"3\"}\n{\"uuid\":\"4\"}\n",
+	}
+	for name, data := range want {
+		got, _ := os.ReadFile(path.Join(queuePath, name))
+		if string(got) != data {
+			t.Errorf("%v = %q, want %q", name, got, data)
+		}
+	}
+	if _, err := os.Stat(path.Join(queuePath, "produce-0000000001.jsonl.done")); err != nil {
+		t.Errorf("not sealed - %v", err)
+	}
+
+	// .done 이 생긴 것만 읽는 파이프라인도 넘어간 파일을 읽는다.
+	backend := NewFileBackend(queuePath, true)
+	if got := itemData(mustTake(t, backend, 10), true); !reflect.DeepEqual(got, [][]byte{[]byte(`{"uuid":"1"}`), []byte(`{"uuid":"2"}`)}) {
+		t.Errorf("Take() = %s", got)
+	}
+
+	p3, _ := NewProducer(queuePath, ProducerOptions{Prefix: "aged-", MaxAge: time.Millisecond})
+	defer p3.Close()
+	_ = p3.AppendObject(1)
+	time.Sleep(time.Millisecond * 2)
+	_ = p3.AppendObject(2)
+	if p3.FileName() != "aged-0000000002.jsonl" {
+		t.Errorf("FileName() = %v", p3.FileName())
+	}
+}
+
+func mustTake(t *testing.T, backend QueueBackend, n int) []*Item {
+	taken, err := backend.Take(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return taken
+}
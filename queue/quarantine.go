@@ -0,0 +1,252 @@
+package queue
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// QuarantineDir 는 더이상 믿고 읽을 수 없는 큐파일을 pos 와 함께 치워두는 곳이다.
+const QuarantineDir = "quarantine"
+
+// reportSuffix 는 quarantine/ 에 큐파일과 같이 남기는 진단 파일이다.
+const reportSuffix = ".report.json"
+
+// reportWindow 는 진단에 남길 Offset 앞뒤의 바이트 수이다.
+const reportWindow = 256
+
+// QuarantineReport 는 quarantine/<이름>.report.json 으로 남는다.
+type QuarantineReport struct {
+	Name   string // quarantine/ 안의 이름
+	File   string // 원래 큐파일 이름
+	Error  string
+	Offset int64
+	At     time.Time
+	Before string `json:",omitempty"` // Offset 앞의 내용. 압축파일과 .xlsx 는 남기지 않는다.
+	After  string `json:",omitempty"` // Offset 부터의 내용
+}
+
+// quarantine 은 큐파일, pos, done 을 quarantine/ 로 옮기고 진단을 남긴 뒤 ErrQuarantined 를 돌려준다.
+func (fq *FileQueue) quarantine(reason string) error {
+	logger := logrus.WithFields(logrus.Fields{"ctx": "queue/FileQueue.quarantine", "path": path.Join(fq.QueuePath, fq.FileQueueName)})
+	logger.Warnf("Quarantine at offset %v - %v", fq.Pos.Offset, reason)
+
+	quarantinePath := path.Join(fq.QueuePath, QuarantineDir)
+	err := os.MkdirAll(quarantinePath, 0755)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	name := fq.FileQueueName
+	if _, err := os.Stat(path.Join(quarantinePath, name)); err == nil {
+		name = fmt.Sprintf("%v.%v", name, now.Format("20060102T150405"))
+	}
+	report := QuarantineReport{Name: name, File: fq.FileQueueName, Error: reason, Offset: fq.Pos.Offset, At: now}
+	if fq.seekable() {
+		report.Before, report.After = surroundingBytes(path.Join(fq.QueuePath, fq.FileQueueName), fq.Pos.Offset)
+	}
+
+	err = os.Rename(path.Join(fq.QueuePath, fq.FileQueueName), path.Join(quarantinePath, name))
+	if err != nil {
+		return err
+	}
+	for _, ext := range []string{".pos", ".done"} {
+		err = os.Rename(path.Join(fq.QueuePath, fq.FileQueueName+ext), path.Join(quarantinePath, name+ext))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	marshaled, _ := json.MarshalIndent(report, "", "  ")
+	err = writeFileSync(path.Join(quarantinePath, name+reportSuffix), marshaled)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w - %v", ErrQuarantined, reason)
+}
+
+// surroundingBytes 는 offset 앞뒤 reportWindow 바이트를 읽는다. 못 읽으면 비워둔다.
+func surroundingBytes(filePath string, offset int64) (string, string) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", ""
+	}
+	defer file.Close()
+	from := offset - reportWindow
+	if from < 0 {
+		from = 0
+	}
+	before := make([]byte, offset-from)
+	n, _ := file.ReadAt(before, from)
+	after := make([]byte, reportWindow)
+	m, _ := file.ReadAt(after, offset)
+	return string(before[:n]), string(after[:m])
+}
+
+// quarantineStuck 은 LastError 로 멈춘 큐파일을 quarantine/ 로 옮긴다.
+// Ack 를 기다리는 Item 이 있는 파일을 옮기지 않도록 실행의 처음에만 부른다.
+func (backend *FileBackend) quarantineStuck() error {
+	dirs, err := os.ReadDir(backend.QueuePath)
+	if err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		if d.IsDir() || !IsQueueFileName(d.Name()) {
+			continue
+		}
+		fq, err := NewFileQueue(backend.QueuePath, d.Name())
+		if err != nil || fq.Pos.LastError == "" {
+			continue
+		}
+		err = fq.quarantine(fq.Pos.LastError)
+		if !errors.Is(err, ErrQuarantined) {
+			return err
+		}
+	}
+	return nil
+}
+
+// QuarantinedFiles 는 quarantine/ 의 큐파일마다 진단을 돌려준다. 진단이 없으면 이름만 채운다.
+func (pipe *Pipeline) QuarantinedFiles() ([]QuarantineReport, error) {
+	quarantinePath := path.Join(pipe.queuePath, QuarantineDir)
+	dirs, err := os.ReadDir(quarantinePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var reports []QuarantineReport
+	for _, d := range dirs {
+		name := d.Name()
+		if d.IsDir() || strings.HasSuffix(name, ".pos") || strings.HasSuffix(name, ".done") || strings.HasSuffix(name, reportSuffix) || strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+		report, err := readQuarantineReport(quarantinePath, name)
+		if err != nil {
+			return reports, err
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func readQuarantineReport(quarantinePath, name string) (QuarantineReport, error) {
+	report := QuarantineReport{Name: name, File: name}
+	b, err := os.ReadFile(path.Join(quarantinePath, name+reportSuffix))
+	if os.IsNotExist(err) {
+		// 같은 이름이 있어서 시각을 붙인 것은 그 시각을 떼어야 원래 이름이다.
+		if !IsQueueFileName(name) {
+			report.File = strings.TrimSuffix(name, path.Ext(name))
+		}
+		return report, nil
+	}
+	if err != nil {
+		return report, err
+	}
+	err = json.Unmarshal(b, &report)
+	return report, err
+}
+
+// ResumeQuarantined 는 quarantine/ 의 name 을 원래 자리로 되돌리고 LastError 를 지운다.
+// skip 이면 Offset 의 한 줄을 건너뛰고, 아니면 그 줄부터 다시 읽는다. 되돌린 Offset 을 돌려준다.
+// 운영자가 고친 파일을 그대로 믿으므로 크기와 해시는 지금 파일로 다시 남긴다.
+// 데몬과 같이 돌 때는 파이프라인 잠금 안에서 불러야 한다.
+func (pipe *Pipeline) ResumeQuarantined(name string, skip bool) (int64, error) {
+	logger := logrus.WithFields(logrus.Fields{"ctx": "queue/Pipeline.ResumeQuarantined", "path": pipe.queuePath})
+	quarantinePath := path.Join(pipe.queuePath, QuarantineDir)
+	if strings.ContainsAny(name, `/\`) {
+		return 0, fmt.Errorf("%v is not a quarantined file", name)
+	}
+	report, err := readQuarantineReport(quarantinePath, name)
+	if err != nil {
+		return 0, err
+	}
+	if !IsQueueFileName(report.File) {
+		return 0, fmt.Errorf("%v is not a queue file", report.File)
+	}
+	if _, err := os.Stat(path.Join(pipe.queuePath, report.File)); err == nil {
+		return 0, fmt.Errorf("%v already exists", report.File)
+	}
+	var pos FileQueuePos
+	posData, err := os.ReadFile(path.Join(quarantinePath, name+".pos"))
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	if err == nil {
+		err = json.Unmarshal(posData, &pos)
+		if err != nil {
+			return 0, fmt.Errorf("invalid pos file. fix or remove %v.pos - %v", name, err)
+		}
+	}
+
+	err = os.Rename(path.Join(quarantinePath, name), path.Join(pipe.queuePath, report.File))
+	if err != nil {
+		return 0, err
+	}
+	fq := &FileQueue{QueuePath: pipe.queuePath, FileQueueName: report.File, Pos: pos, csv: pipe.Csv, xlsx: pipe.Xlsx}
+	fq.Pos.LastError = ""
+	// Offset 앞이 잘려나갔으면 이미 읽은 것을 다시 보내지 않도록 파일 끝부터 읽는다. 다른 곳은 pos rewind 로 고른다.
+	if stat, statErr := os.Stat(path.Join(pipe.queuePath, report.File)); statErr == nil && fq.seekable() && stat.Size() < fq.Pos.Offset {
+		logger.Warnf("%v is shorter than offset %v. Resume at the end %v", report.File, fq.Pos.Offset, stat.Size())
+		fq.Pos.Offset = stat.Size()
+	}
+	if skip {
+		fq.Pos.Offset, err = fq.nextLine(fq.Pos.Offset)
+	}
+	if err == nil {
+		err = fq.SyncPos()
+	}
+	if err != nil {
+		// 아무것도 바꾸지 않은 채로 되돌려놓는다.
+		os.Remove(path.Join(pipe.queuePath, report.File+".pos"))
+		if renameErr := os.Rename(path.Join(pipe.queuePath, report.File), path.Join(quarantinePath, name)); renameErr != nil {
+			logger.Warnf("Can not move %v back to quarantine - %v", report.File, renameErr)
+		}
+		return 0, err
+	}
+	err = os.Rename(path.Join(quarantinePath, name+".done"), path.Join(pipe.queuePath, report.File+".done"))
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	os.Remove(path.Join(quarantinePath, name+".pos"))
+	os.Remove(path.Join(quarantinePath, name+reportSuffix))
+	logger.Infof("Resumed %v at offset %v", report.File, fq.Pos.Offset)
+	return fq.Pos.Offset, syncDir(pipe.queuePath)
+}
+
+// nextLine 은 offset 에서 시작하는 한 줄의 끝이다. 평문은 읽을 수 없는 줄도 줄바꿈까지 건너뛴다.
+func (fq *FileQueue) nextLine(offset int64) (int64, error) {
+	if !fq.seekable() {
+		rd, err := fq.openReader(offset)
+		if err != nil {
+			return 0, err
+		}
+		defer rd.Close()
+		_, next, err := rd.Next()
+		if err = ignoreRowError(err); err != nil {
+			return 0, fmt.Errorf("can not skip a line at %v - %w", offset, err)
+		}
+		return next, nil
+	}
+	file, err := os.Open(path.Join(fq.QueuePath, fq.FileQueueName))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	line, err := bufio.NewReader(file).ReadBytes('\n')
+	if len(line) == 0 {
+		return 0, fmt.Errorf("can not skip a line at %v - %w", offset, err)
+	}
+	return offset + int64(len(line)), nil
+}
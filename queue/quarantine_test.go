@@ -0,0 +1,97 @@
+package queue
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestPipeline_ResumeQuarantined(t *testing.T) {
+	queuePath := path.Join(testBase, "quarantine_test1")
+	_ = os.MkdirAll(queuePath, 0755)
+	_ = os.WriteFile(path.Join(queuePath, "data.jsonl"), []byte("{\"a\":1}\nBAD\n{\"a\":3}\n"), 0644)
+	fq, err := NewFileQueue(queuePath, "data.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fq.Pos.Offset, fq.Pos.LastError = 8, "broken"
+	_ = fq.SyncPos()
+
+	// LastError 로 멈춘 파일은 실행의 처음에 quarantine/ 로 옮긴다.
+	backend := NewFileBackend(queuePath, false)
+	if taken := mustTake(t, backend, 10); len(taken) != 0 {
+		t.Errorf("Take() = %v", itemData(taken, false))
+	}
+	backend.Close()
+	if _, err := os.Stat(path.Join(queuePath, "data.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("queue file left")
+	}
+	b, err := os.ReadFile(path.Join(queuePath, QuarantineDir, "data.jsonl"+reportSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report QuarantineReport
+	_ = json.Unmarshal(b, &report)
+	if report.File != "data.jsonl" || report.Error != "broken" || report.Offset != 8 || report.Before != "{\"a\":1}\n" || report.After != "BAD\n{\"a\":3}\n" {
+		t.Errorf("report = %+v", report)
+	}
+
+	pipe := &Pipeline{queuePath: queuePath}
+	reports, err := pipe.QuarantinedFiles()
+	if err != nil || len(reports) != 1 || reports[0].Name != "data.jsonl" {
+		t.Errorf("QuarantinedFiles() = %+v, %v", reports, err)
+	}
+	offset, err := pipe.ResumeQuarantined("data.jsonl", true)
+	if err != nil || offset != 12 {
+		t.Fatalf("ResumeQuarantined() = %v, %v", offset, err)
+	}
+	if reports, _ := pipe.QuarantinedFiles(); len(reports) != 0 {
+		t.Errorf("QuarantinedFiles() = %+v", reports)
+	}
+
+	backend = NewFileBackend(queuePath, false)
+	defer backend.Close()
+	if got := itemData(mustTake(t, backend, 10), false); !reflect.DeepEqual(got, [][]byte{[]byte(`{"a":3}`)}) {
+		t.Errorf("Take() = %s", got)
+	}
+}
+
+func TestPipeline_ResumeQuarantinedTruncated(t *testing.T) {
+	queuePath := path.Join(testBase, "quarantine_test2")
+	_ = os.MkdirAll(queuePath, 0755)
+	fqPath := path.Join(queuePath, "data.jsonl")
+	_ = os.WriteFile(fqPath, []byte("{\"a\":1}\n{\"a\":2}\n{\"a\":3}\n"), 0644)
+	fq, err := NewFileQueue(queuePath, "data.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = fq.movePos(16)
+
+	// 읽은 위치보다 짧게 잘린 파일은 열 때 quarantine/ 로 옮긴다.
+	_ = os.WriteFile(fqPath, []byte("{\"a\":1}\n"), 0644)
+	if _, err := NewFileQueue(queuePath, "data.jsonl"); err == nil {
+		t.Fatal("NewFileQueue() of truncated file = nil")
+	}
+	pipe := &Pipeline{queuePath: queuePath}
+	offset, err := pipe.ResumeQuarantined("data.jsonl", false)
+	if err != nil || offset != 8 {
+		t.Fatalf("ResumeQuarantined() = %v, %v", offset, err)
+	}
+
+	// 지금의 크기와 해시로 남았으므로 다시 격리되지 않고 뒤에 붙은 것부터 읽는다.
+	f, _ := os.OpenFile(fqPath, os.O_APPEND|os.O_WRONLY, 0644)
+	_, _ = f.WriteString("{\"a\":4}\n")
+	f.Close()
+	fq, err = NewFileQueue(queuePath, "data.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items := fq.Reserve(10); len(items) != 1 || string(items[0].Data) != `{"a":4}` {
+		t.Errorf("Reserve() after resume = %v items", len(items))
+	}
+	if reports, _ := pipe.QuarantinedFiles(); len(reports) != 0 {
+		t.Errorf("QuarantinedFiles() = %+v", reports)
+	}
+}
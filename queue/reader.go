@@ -0,0 +1,148 @@
+package queue
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// 큐파일은 확장자로 읽는 방법을 정한다.
+// 압축파일은 Pos.Offset 이 압축을 푼 뒤의 위치이다. .csv/.tsv/.xlsx 는 한 행을 JSON 객체 하나로 읽는다.
+const suffixJsonl = ".jsonl"
+const suffixGzip = ".jsonl.gz"
+const suffixZstd = ".jsonl.zst"
+
+var queueSuffixes = []string{suffixJsonl, suffixGzip, suffixZstd, suffixCsv, suffixTsv, suffixXlsx}
+
+// IsQueueFileName 은 OfferFileQueue 가 큐파일로 읽는 이름인지 확인한다.
+func IsQueueFileName(name string) bool {
+	for _, suffix := range queueSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// seekable 이 아니면 Offset 으로 seek 할 수 없고, 파일 크기와 Offset 을 비교할 수 없다.
+// 압축파일은 Offset 이 압축을 푼 위치이고, .xlsx 는 행 번호이다.
+func (fq *FileQueue) seekable() bool {
+	name := fq.FileQueueName
+	return !strings.HasSuffix(name, suffixGzip) && !strings.HasSuffix(name, suffixZstd) && !strings.HasSuffix(name, suffixXlsx)
+}
+
+// queueReader 는 큐파일에서 한 건씩 읽는다.
+type queueReader interface {
+	// Next 는 한 건과 그 다음 위치를 돌려준다. 온전한 건이 더 없으면 io.EOF 이다.
+	// 행을 JSON 으로 바꾸지 못하면 원본 행과 *RowError 를 돌려주고, 다음 행부터 계속 읽을 수 있다.
+	Next() ([]byte, int64, error)
+	Close() error
+}
+
+// RowError 는 .csv/.tsv/.xlsx 의 한 행을 JSON 으로 바꾸지 못한 이유이다. 파일이 깨진 것은 아니다.
+type RowError struct {
+	Err error
+}
+
+func (e *RowError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// ignoreRowError 는 바꾸지 못한 행도 한 건으로 셀 때 쓴다.
+func ignoreRowError(err error) error {
+	var rowErr *RowError
+	if errors.As(err, &rowErr) {
+		return nil
+	}
+	return err
+}
+
+// openReader 는 pos 부터 읽는 queueReader 를 연다.
+func (fq *FileQueue) openReader(pos int64) (queueReader, error) {
+	if strings.HasSuffix(fq.FileQueueName, suffixXlsx) {
+		return fq.openXlsxReader(pos)
+	}
+	file, err := os.Open(path.Join(fq.QueuePath, fq.FileQueueName))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasSuffix(fq.FileQueueName, suffixGzip):
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return newSkippedLineReader(gz, pos, file.Close)
+	case strings.HasSuffix(fq.FileQueueName, suffixZstd):
+		zr, err := zstd.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return newSkippedLineReader(zr, pos, func() error {
+			zr.Close()
+			return file.Close()
+		})
+	case isCsvFileName(fq.FileQueueName):
+		return fq.openCsvReader(file, pos)
+	}
+	_, err = file.Seek(pos, io.SeekStart)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &lineReader{rd: bufio.NewReader(file), pos: pos, closed: fq.IsDone(), close: file.Close}, nil
+}
+
+// newSkippedLineReader 는 압축을 풀면서 pos 까지 버린다. 압축파일은 다 쓴 뒤에 들어오므로 닫힌 파일로 본다.
+func newSkippedLineReader(rd io.Reader, pos int64, close func() error) (queueReader, error) {
+	_, err := io.CopyN(io.Discard, rd, pos)
+	if err != nil {
+		close()
+		return nil, err
+	}
+	return &lineReader{rd: bufio.NewReader(rd), pos: pos, closed: true, close: close}, nil
+}
+
+// lineReader 는 한 줄을 한 건으로 읽는다. 빈 줄은 빈 건으로 돌려준다.
+type lineReader struct {
+	rd     *bufio.Reader
+	pos    int64
+	closed bool // 더 쓰이지 않는 파일이면 줄바꿈 없는 마지막 줄도 읽는다.
+	close  func() error
+}
+
+func (r *lineReader) Next() ([]byte, int64, error) {
+	bytes, err := r.rd.ReadBytes('\n')
+	if errors.Is(err, io.EOF) { // err이 있더라도 bytes는 채워져있음
+		// 줄바꿈 없는 마지막 줄은 아직 쓰고 있는 중일 수 있다. 닫힌 파일이 아니면 다음번에 읽는다.
+		if len(bytes) == 0 || !r.closed {
+			return nil, r.pos, io.EOF
+		}
+	} else if err != nil {
+		return nil, r.pos, err
+	}
+	r.pos += int64(len(bytes))
+
+	if len(bytes) > 0 && bytes[len(bytes)-1] == '\n' {
+		bytes = bytes[:len(bytes)-1]
+	}
+	if len(bytes) > 0 && bytes[len(bytes)-1] == '\r' {
+		bytes = bytes[:len(bytes)-1]
+	}
+	return bytes, r.pos, nil
+}
+
+func (r *lineReader) Close() error {
+	return r.close()
+}
@@ -0,0 +1,113 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Duration 은 config.json 에서 "30s" 같은 문자열이나 초 단위 숫자로 쓴다.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case float64:
+		*d = Duration(value * float64(time.Second))
+	case string:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	default:
+		return errors.New("invalid duration")
+	}
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   Duration
+	MaxDelay    Duration
+	Jitter      float64 // 0~1. 대기시간에 최대 이 비율만큼 무작위로 더한다.
+}
+
+// ShouldRetry 는 요청 실패나 2xx 가 아닌 응답을 아직 시도횟수가 남았을 때만 재시도한다.
+func (policy RetryPolicy) ShouldRetry(res *Res, attempt int) bool {
+	if attempt >= policy.MaxAttempts {
+		return false
+	}
+	return res.Err != "" || res.StatusCode < 200 || res.StatusCode >= 300
+}
+
+// Delay 는 attempt 번째 시도가 실패한 뒤 기다릴 시간이다.
+func (policy RetryPolicy) Delay(attempt int) time.Duration {
+	delay := time.Duration(policy.BaseDelay)
+	if delay <= 0 {
+		delay = time.Second
+	}
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if policy.MaxDelay > 0 && delay >= time.Duration(policy.MaxDelay) {
+			break
+		}
+	}
+	if policy.MaxDelay > 0 && delay > time.Duration(policy.MaxDelay) {
+		delay = time.Duration(policy.MaxDelay)
+	}
+	if policy.Jitter > 0 {
+		delay += time.Duration(rand.Float64() * policy.Jitter * float64(delay))
+	}
+	return delay
+}
+
+const retryPrefix = "retry-"
+const retryTimeFormat = "20060102T150405Z"
+
+type retryEnvelope struct {
+	Attempt int
+	Data    string
+}
+
+// RetryLater 는 Item 을 재시도 대기시간 뒤에 다음 시도번호로 다시 나오게 한다.
+func (pipe *Pipeline) RetryLater(item *Item) (time.Time, error) {
+	retryAt := time.Now().Add(pipe.Retry.Delay(item.Attempt))
+	return retryAt, item.Nack(retryAt)
+}
+
+func isRetryQueue(queueName string) bool {
+	return strings.HasPrefix(queueName, retryPrefix)
+}
+
+// retryNotBefore 는 retry 파일이름에서 시각을 꺼낸다. retry 파일이 아니면 false.
+func retryNotBefore(queueName string) (time.Time, bool) {
+	if !isRetryQueue(queueName) {
+		return time.Time{}, false
+	}
+	stamp := strings.TrimSuffix(strings.TrimPrefix(queueName, retryPrefix), ".jsonl")
+	notBefore, err := time.Parse(retryTimeFormat, stamp)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return notBefore, true
+}
+
+// unwrapRetry 는 retry 파일의 한 줄을 원래 Item 과 시도번호로 되돌린다.
+func unwrapRetry(line []byte) ([]byte, int) {
+	var envelope retryEnvelope
+	err := json.Unmarshal(line, &envelope)
+	if err != nil || envelope.Attempt < 1 {
+		return line, 1
+	}
+	return []byte(envelope.Data), envelope.Attempt
+}
@@ -0,0 +1,126 @@
+package queue
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{name: "default base", policy: RetryPolicy{}, attempt: 1, want: time.Second},
+		{name: "first", policy: RetryPolicy{BaseDelay: Duration(time.Second * 10)}, attempt: 1, want: time.Second * 10},
+		{name: "exponential", policy: RetryPolicy{BaseDelay: Duration(time.Second * 10)}, attempt: 3, want: time.Second * 40},
+		{name: "capped", policy: RetryPolicy{BaseDelay: Duration(time.Second * 10), MaxDelay: Duration(time.Second * 30)}, attempt: 3, want: time.Second * 30},
+		{name: "capped many", policy: RetryPolicy{BaseDelay: Duration(time.Second * 10), MaxDelay: Duration(time.Minute)}, attempt: 100, want: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Delay(tt.attempt); got != tt.want {
+				t.Errorf("Delay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	jittered := RetryPolicy{BaseDelay: Duration(time.Second * 10), Jitter: 0.5}.Delay(1)
+	if jittered < time.Second*10 || jittered > time.Second*15 {
+		t.Errorf("Delay() with jitter = %v", jittered)
+	}
+}
+
+func TestRetryPolicy_ShouldRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3}
+	tests := []struct {
+		name    string
+		res     *Res
+		attempt int
+		want    bool
+	}{
+		{name: "ok", res: &Res{StatusCode: 200}, attempt: 1, want: false},
+		{name: "http error", res: &Res{Err: "timeout"}, attempt: 1, want: true},
+		{name: "server error", res: &Res{StatusCode: 503}, attempt: 2, want: true},
+		{name: "exhausted", res: &Res{StatusCode: 503}, attempt: 3, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.ShouldRetry(tt.res, tt.attempt); got != tt.want {
+				t.Errorf("ShouldRetry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPipeline_RetryLater(t *testing.T) {
+	configPath := path.Join(testBase, "retry_test1", "_config.json")
+	pipe := newQueue(configPath)
+	if pipe.Retry.MaxAttempts != 3 || pipe.Retry.BaseDelay != Duration(time.Minute) || pipe.Retry.MaxDelay != Duration(time.Minute*5) {
+		t.Errorf("Retry = %#v", pipe.Retry)
+	}
+
+	// 시각이 지난 retry 파일은 시도번호와 함께 나온다.
+	taken := pipe.Take()
+	if got := itemData(taken, false); !reflect.DeepEqual(got, [][]byte{[]byte(`{"uuid":"1"}`), []byte(`{"uuid":"2"}`), []byte(`{"uuid":"0"}`)}) {
+		t.Fatalf("Take() = %s", got)
+	}
+	if taken[0].Attempt != 1 || taken[2].Attempt != 2 {
+		t.Errorf("Attempt = %v, %v", taken[0].Attempt, taken[2].Attempt)
+	}
+
+	before := time.Now()
+	retryAt, err := pipe.RetryLater(taken[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retryAt.Before(before.Add(time.Minute * 2)) {
+		t.Errorf("RetryLater() = %v", retryAt)
+	}
+	for _, item := range taken {
+		_ = item.Ack()
+	}
+
+	// 아직 시각이 안된 retry 파일은 내주지 않는다.
+	if got := newQueue(configPath).Take(); len(got) != 0 {
+		t.Errorf("Take() before retry time = %s", itemData(got, false))
+	}
+	queues, _ := ListFileQueues(path.Join(testBase, "retry_test1"))
+	if len(queues) != 0 {
+		t.Errorf("ListFileQueues() = %v", len(queues))
+	}
+}
+
+func TestItem_NackReserved(t *testing.T) {
+	queuePath := path.Join(testBase, "retry_test2")
+	_ = os.MkdirAll(queuePath, 0755)
+	_ = os.WriteFile(path.Join(queuePath, "data.jsonl"), []byte(`{"uuid":"1"}`+"\n"+`{"uuid":"2"}`+"\n"), 0644)
+	fq, err := NewFileQueue(queuePath, "data.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := fq.Reserve(2)
+	if len(items) != 2 {
+		t.Fatalf("Reserve() = %v items", len(items))
+	}
+
+	// Backend 없이 꺼낸 것도 큐파일 옆의 retry 파일로 옮긴다.
+	if err := items[0].Nack(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := items[1].Defer(time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if !fq.IsEOF() {
+		t.Error("reserved items are not acked")
+	}
+	retries, _ := filepath.Glob(path.Join(queuePath, retryPrefix+"*.jsonl"))
+	if len(retries) != 2 {
+		t.Errorf("retry files = %v", retries)
+	}
+}
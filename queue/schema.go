@@ -0,0 +1,76 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"path"
+	"sort"
+	"strings"
+)
+
+// SchemaViolation 은 Item 이 Schema 에 맞지 않는 곳 하나이다.
+type SchemaViolation struct {
+	Pointer string // Item 안의 JSON pointer. "" 은 Item 전체이다.
+	Keyword string // 맞지 않은 Schema 의 위치
+	Message string
+}
+
+// InvalidItemError 는 Schema 에 맞지 않는 곳을 모두 담는다.
+type InvalidItemError struct {
+	Violations []SchemaViolation
+}
+
+func (e *InvalidItemError) Error() string {
+	var msgs []string
+	for _, v := range e.Violations {
+		msgs = append(msgs, fmt.Sprintf("%q %v", v.Pointer, v.Message))
+	}
+	return "invalid item: " + strings.Join(msgs, ", ")
+}
+
+func (pipe *Pipeline) loadSchema() error {
+	if pipe.SchemaName == "" {
+		return nil
+	}
+	schema, err := jsonschema.Compile(path.Join(pipe.queuePath, pipe.SchemaName))
+	if err != nil {
+		return fmt.Errorf("SchemaName %v - %w", pipe.SchemaName, err)
+	}
+	pipe.schema = schema
+	return nil
+}
+
+// Validate 는 SchemaName 이 있으면 o 를 검사한다. 맞지 않으면 *InvalidItemError 이다.
+func (pipe *Pipeline) Validate(o interface{}) error {
+	if pipe.schema == nil {
+		return nil
+	}
+	err := pipe.schema.Validate(o)
+	var verr *jsonschema.ValidationError
+	if !errors.As(err, &verr) {
+		return err
+	}
+	invalid := &InvalidItemError{}
+	collectViolations(verr, invalid)
+	// properties 는 순서 없이 검사하므로 같은 Item 이면 같은 순서로 남도록 정렬한다.
+	sort.SliceStable(invalid.Violations, func(i, j int) bool {
+		return invalid.Violations[i].Pointer < invalid.Violations[j].Pointer
+	})
+	return invalid
+}
+
+// collectViolations 는 원인의 끝에 있는 것만 모은다. 위쪽은 "다음이 맞지 않는다" 정도의 말만 있다.
+func collectViolations(verr *jsonschema.ValidationError, invalid *InvalidItemError) {
+	if len(verr.Causes) == 0 {
+		invalid.Violations = append(invalid.Violations, SchemaViolation{
+			Pointer: verr.InstanceLocation,
+			Keyword: verr.KeywordLocation,
+			Message: verr.Message,
+		})
+		return
+	}
+	for _, cause := range verr.Causes {
+		collectViolations(cause, invalid)
+	}
+}
@@ -0,0 +1,52 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestPipeline_Validate(t *testing.T) {
+	pipe, err := NewPipelineFromConfigPath(path.Join(testBase, "schema_test1", "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		data string
+		want []string
+	}{
+		{data: `{"id":"1","user":{"age":3},"tags":["a"]}`},
+		{data: `{"id":1,"user":{"age":-1}}`, want: []string{"/id", "/user/age"}},
+		{data: `{"id":"1","user":{},"tags":["a",2]}`, want: []string{"/tags/1"}},
+		{data: `{"id":"1"}`, want: []string{""}},
+	}
+	for _, tt := range tests {
+		var o interface{}
+		_ = json.Unmarshal([]byte(tt.data), &o)
+		err := pipe.Validate(o)
+		var invalid *InvalidItemError
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("Validate(%v) = %v", tt.data, err)
+			}
+			continue
+		}
+		if !errors.As(err, &invalid) {
+			t.Errorf("Validate(%v) = %v", tt.data, err)
+			continue
+		}
+		var got []string
+		for _, v := range invalid.Violations {
+			got = append(got, v.Pointer)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Validate(%v) pointers = %q, want %q - %v", tt.data, got, tt.want, err)
+		}
+	}
+
+	if _, err := NewPipeline(path.Join(testBase, "schema_test1"), []byte(`{"OutputPath":"out.log","UniqueKey":"$.id","SchemaName":"none.json"}`)); err == nil {
+		t.Errorf("NewPipeline() with missing schema")
+	}
+}
@@ -0,0 +1,247 @@
+package queue
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/sirupsen/logrus"
+	_ "modernc.org/sqlite"
+	"path"
+	"sync"
+	"time"
+)
+
+// SqliteBackendName 은 파이프라인 디렉토리 안의 SQLite 파일이다.
+const SqliteBackendName = "_queue.db"
+
+type ItemState string
+
+const ItemStatePending = ItemState("PENDING")
+const ItemStateInFlight = ItemState("INFLIGHT")
+const ItemStateDone = ItemState("DONE")
+const ItemStateFailed = ItemState("FAILED")
+
+// SqliteBackend 는 Item 마다 상태와 시도횟수를 SQLite 에 남긴다.
+// 파이프라인 디렉토리에 들어온 .jsonl 파일은 Take 할 때 가져와서 같은 테이블에 넣는다.
+type SqliteBackend struct {
+	QueuePath   string
+	WaitForDone bool
+	db          *sql.DB
+	files       *FileBackend
+	recovered   bool
+	mu          sync.Mutex
+}
+
+func NewSqliteBackend(queuePath string, waitForDone bool) (*SqliteBackend, error) {
+	db, err := sql.Open("sqlite", path.Join(queuePath, SqliteBackendName))
+	if err != nil {
+		return nil, err
+	}
+	// 한 연결만 쓰면 프로세스 안에서는 SQLITE_BUSY 가 나지 않는다.
+	db.SetMaxOpenConns(1)
+	for _, stmt := range []string{
+		`PRAGMA journal_mode=WAL`,
+		`PRAGMA busy_timeout=5000`,
+		`CREATE TABLE IF NOT EXISTS items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			data BLOB NOT NULL,
+			state TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			not_before INTEGER NOT NULL DEFAULT 0,
+			source TEXT NOT NULL DEFAULT '',
+			row_error TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS items_state ON items (state, not_before, id)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	// row_error 가 생기기 전에 만든 파일에는 컬럼을 더한다.
+	var hasRowError int
+	err = db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('items') WHERE name = 'row_error'`).Scan(&hasRowError)
+	if err == nil && hasRowError == 0 {
+		_, err = db.Exec(`ALTER TABLE items ADD COLUMN row_error TEXT NOT NULL DEFAULT ''`)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SqliteBackend{
+		QueuePath:   queuePath,
+		WaitForDone: waitForDone,
+		db:          db,
+		files:       NewFileBackend(queuePath, waitForDone),
+	}, nil
+}
+
+func (backend *SqliteBackend) Offer(data []byte) error {
+	return backend.insert(backend.db, data, "offer", nil)
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// insert 는 rowErr 가 있으면 그 이유를 같이 남겨서 Take 할 때 Item.Err 로 돌려준다.
+func (backend *SqliteBackend) insert(db execer, data []byte, source string, rowErr error) error {
+	var reason string
+	if rowErr != nil {
+		reason = rowErr.Error()
+	}
+	now := time.Now().UnixMilli()
+	_, err := db.Exec(`INSERT INTO items (data, state, source, row_error, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		data, ItemStatePending, source, reason, now, now)
+	return err
+}
+
+func (backend *SqliteBackend) Take(n int) ([]*Item, error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	var taken = make([]*Item, 0)
+	if n <= 0 {
+		return taken, nil
+	}
+	// 지난 실행이 끝내지 못한 것은 시도하지 않은 것으로 되돌린다.
+	// Take 는 파이프라인 잠금 안에서만 불리므로 다른 실행의 INFLIGHT 를 건드리지 않는다.
+	if !backend.recovered {
+		_, err := backend.db.Exec(`UPDATE items SET state = ?, attempts = attempts - 1 WHERE state = ?`, ItemStatePending, ItemStateInFlight)
+		if err != nil {
+			return taken, err
+		}
+		backend.recovered = true
+	}
+	err := backend.importFiles()
+	if err != nil {
+		return taken, err
+	}
+
+	tx, err := backend.db.Begin()
+	if err != nil {
+		return taken, err
+	}
+	defer tx.Rollback()
+	now := time.Now().UnixMilli()
+	rows, err := tx.Query(`SELECT id, data, attempts, source, row_error FROM items WHERE state = ? AND not_before <= ? ORDER BY id LIMIT ?`,
+		ItemStatePending, now, n)
+	if err != nil {
+		return taken, err
+	}
+	for rows.Next() {
+		item := &Item{backend: backend}
+		var rowErr string
+		err := rows.Scan(&item.id, &item.Data, &item.Attempt, &item.source, &rowErr)
+		if err != nil {
+			rows.Close()
+			return make([]*Item, 0), err
+		}
+		if rowErr != "" {
+			item.Err = &RowError{Err: errors.New(rowErr)}
+		}
+		item.Attempt++
+		taken = append(taken, item)
+	}
+	rows.Close()
+	for _, item := range taken {
+		_, err := tx.Exec(`UPDATE items SET state = ?, attempts = ?, updated_at = ? WHERE id = ?`, ItemStateInFlight, item.Attempt, now, item.id)
+		if err != nil {
+			return make([]*Item, 0), err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return make([]*Item, 0), err
+	}
+	return taken, nil
+}
+
+// importFiles 는 디렉토리에 들어온 큐파일을 모두 테이블로 옮긴다. 넣은 뒤에 Ack 하므로 중간에 죽으면 다시 넣는다.
+func (backend *SqliteBackend) importFiles() error {
+	logger := logrus.WithFields(logrus.Fields{"ctx": "queue/SqliteBackend.importFiles", "path": backend.QueuePath})
+	for {
+		items, err := backend.files.Take(1000)
+		if err != nil || len(items) == 0 {
+			return err
+		}
+		tx, err := backend.db.Begin()
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			err := backend.insert(tx, item.Data, item.Source(), item.Err)
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := item.Ack(); err != nil {
+				logger.Warn(err)
+			}
+		}
+		logger.Debugf("Imported %v items", len(items))
+	}
+}
+
+func (backend *SqliteBackend) Ack(item *Item) error {
+	return backend.setState(item, ItemStateDone, 0)
+}
+
+func (backend *SqliteBackend) Nack(item *Item, retryAt time.Time) error {
+	if retryAt.IsZero() {
+		return backend.setState(item, ItemStateFailed, 0)
+	}
+	return backend.setState(item, ItemStatePending, retryAt.UnixMilli())
+}
+
+// Defer 는 Take 에서 올린 attempts 를 되돌린다.
+func (backend *SqliteBackend) Defer(item *Item, notBefore time.Time) error {
+	_, err := backend.db.Exec(`UPDATE items SET state = ?, not_before = ?, attempts = attempts - 1, updated_at = ? WHERE id = ?`,
+		ItemStatePending, notBefore.UnixMilli(), time.Now().UnixMilli(), item.id)
+	return err
+}
+
+func (backend *SqliteBackend) setState(item *Item, state ItemState, notBefore int64) error {
+	_, err := backend.db.Exec(`UPDATE items SET state = ?, not_before = ?, updated_at = ? WHERE id = ?`,
+		state, notBefore, time.Now().UnixMilli(), item.id)
+	return err
+}
+
+func (backend *SqliteBackend) Stats() (QueueStats, error) {
+	var stats QueueStats
+	rows, err := backend.db.Query(`SELECT state, COUNT(*) FROM items GROUP BY state`)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var state ItemState
+		var count int64
+		if err := rows.Scan(&state, &count); err != nil {
+			return stats, err
+		}
+		switch state {
+		case ItemStatePending:
+			stats.Pending = count
+		case ItemStateInFlight:
+			stats.InFlight = count
+		case ItemStateDone:
+			stats.Done = count
+		case ItemStateFailed:
+			stats.Failed = count
+		}
+	}
+	return stats, rows.Err()
+}
+
+func (backend *SqliteBackend) Close() error {
+	backend.files.Close()
+	return backend.db.Close()
+}
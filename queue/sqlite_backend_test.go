@@ -0,0 +1,102 @@
+package queue
+
+import (
+	"errors"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSqliteBackend(t *testing.T) {
+	queuePath := path.Join(testBase, "sqlite_backend_test1")
+	backend, err := NewSqliteBackend(queuePath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := backend.Offer([]byte(`{"uuid":"3"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 디렉토리의 큐파일을 먼저 가져오고, Offer 한 것이 뒤에 나온다.
+	taken, err := backend.Take(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := itemData(taken, false); !reflect.DeepEqual(got, [][]byte{[]byte(`{"uuid":"3"}`), []byte(`{"uuid":"1"}`)}) {
+		t.Errorf("Take() = %s", got)
+	}
+	if taken[1].Source() != "data.jsonl" || taken[1].Attempt != 1 {
+		t.Errorf("Source() = %v, Attempt = %v", taken[1].Source(), taken[1].Attempt)
+	}
+	if fq, _ := NewFileQueue(queuePath, "data.jsonl"); !fq.IsEOF() {
+		t.Errorf("queue file not imported")
+	}
+
+	_ = taken[0].Ack()
+	_ = taken[1].Nack(time.Now().Add(time.Hour))
+	stats, _ := backend.Stats()
+	if stats != (QueueStats{Pending: 2, Done: 1}) {
+		t.Errorf("Stats() = %#v", stats)
+	}
+
+	// 아직 시각이 안된 것은 나오지 않는다.
+	next, _ := backend.Take(10)
+	if got := itemData(next, false); !reflect.DeepEqual(got, [][]byte{[]byte(`{"uuid":"2"}`)}) {
+		t.Errorf("Take() = %s", got)
+	}
+	_ = next[0].Nack(time.Time{})
+	backend.Close()
+
+	// 다시 열면 INFLIGHT 였던 것이 시도횟수 그대로 다시 나온다.
+	backend, err = NewSqliteBackend(queuePath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	_, _ = backend.db.Exec(`UPDATE items SET not_before = 0 WHERE state = ?`, ItemStatePending)
+	retried, _ := backend.Take(10)
+	if len(retried) != 1 || retried[0].Attempt != 2 {
+		t.Fatalf("Take() after retry = %v", len(retried))
+	}
+	backend.Close()
+	backend, _ = NewSqliteBackend(queuePath, false)
+	redelivered, _ := backend.Take(10)
+	if len(redelivered) != 1 || redelivered[0].Attempt != 2 || string(redelivered[0].Data) != `{"uuid":"1"}` {
+		t.Errorf("Take() after restart = %s", itemData(redelivered, false))
+	}
+	stats, _ = backend.Stats()
+	if stats != (QueueStats{InFlight: 1, Done: 1, Failed: 1}) {
+		t.Errorf("Stats() = %#v", stats)
+	}
+}
+
+func TestSqliteBackend_RowError(t *testing.T) {
+	queuePath := path.Join(testBase, "sqlite_backend_test2")
+	_ = os.MkdirAll(queuePath, 0755)
+	_ = os.WriteFile(path.Join(queuePath, "rows.csv"), []byte("uuid,age\n1,x\n2,3\n"), 0644)
+	backend, err := NewSqliteBackend(queuePath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	backend.files.Csv = CsvOptions{Types: map[string]ColumnType{"age": ColumnTypeInteger}}
+
+	// 바꾸지 못한 행은 테이블을 거쳐도 이유를 들고 나온다.
+	taken, err := backend.Take(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(taken) != 2 {
+		t.Fatalf("Take() = %v items", len(taken))
+	}
+	var rowErr *RowError
+	if string(taken[0].Data) != "1,x" || !errors.As(taken[0].Err, &rowErr) || !strings.HasPrefix(taken[0].Err.Error(), "age - ") {
+		t.Errorf("taken[0] = %s, %v", taken[0].Data, taken[0].Err)
+	}
+	if string(taken[1].Data) != `{"age":3,"uuid":"2"}` || taken[1].Err != nil {
+		t.Errorf("taken[1] = %s, %v", taken[1].Data, taken[1].Err)
+	}
+}
@@ -0,0 +1,35 @@
+package queue
+
+import "context"
+
+// Stream 은 n 개까지 chunk 개씩 Take 해서 하나씩 보낸다. 받는 쪽이 밀리면 다음 Take 도 기다리므로
+// 예약된 채로 들고 있는 Item 은 chunk 개를 넘지 않는다.
+// 다 보냈거나 더 없거나 ctx 가 끝나면 채널을 닫는다. 보내지 못한 Item 은 Ack 되지 않았으므로 다음 실행에서 다시 나온다.
+func (pipe *Pipeline) Stream(ctx context.Context, n int, chunk int) <-chan *Item {
+	if chunk < 1 {
+		chunk = 1
+	}
+	items := make(chan *Item)
+	go func() {
+		defer close(items)
+		for sent := 0; sent < n && ctx.Err() == nil; {
+			k := chunk
+			if n-sent < k {
+				k = n - sent
+			}
+			taken := pipe.TakeN(k)
+			if len(taken) == 0 {
+				return
+			}
+			for _, item := range taken {
+				select {
+				case items <- item:
+					sent++
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return items
+}
@@ -0,0 +1,63 @@
+package queue
+
+import (
+	"context"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPipeline_Stream(t *testing.T) {
+	pipe := &Pipeline{queuePath: path.Join(testBase, "stream_test1")}
+	defer pipe.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	items := pipe.Stream(ctx, 4, 2)
+	first := <-items
+	// 받는 쪽이 멈추면 chunk 보다 더 예약하지 않는다.
+	time.Sleep(time.Millisecond * 50)
+	backend, _ := pipe.Backend()
+	if stats, _ := backend.Stats(); stats.InFlight != 2 {
+		t.Errorf("Stats() = %#v", stats)
+	}
+	_ = first.Ack()
+	var got []string
+	for item := range items {
+		got = append(got, string(item.Data))
+		_ = item.Ack()
+	}
+	if len(got) != 3 || got[2] != `{"id":"4"}` {
+		t.Errorf("Stream() = %v", got)
+	}
+
+	// ctx 가 끝나면 닫힌다. 보내지 못한 것은 다음에 다시 나온다.
+	items = pipe.Stream(ctx, 10, 2)
+	cancel()
+	for range items {
+	}
+	left := pipe.TakeN(10)
+	if len(left) != 1 || string(left[0].Data) != `{"id":"5"}` {
+		t.Errorf("TakeN() = %v", itemData(left, false))
+	}
+}
+
+func TestPipeline_StreamBlankLines(t *testing.T) {
+	queuePath := path.Join(testBase, "stream_test2")
+	_ = os.MkdirAll(queuePath, 0755)
+	_ = os.WriteFile(path.Join(queuePath, "data.jsonl"), []byte("{\"id\":\"a\"}\n\n\n{\"id\":\"b\"}\n"), 0644)
+	pipe := &Pipeline{queuePath: queuePath}
+	defer pipe.Close()
+
+	// 빈 줄은 chunk 에 세지 않으므로 빈 줄 뒤에서 멈추지 않는다.
+	var got []string
+	for item := range pipe.Stream(context.Background(), 10, 1) {
+		got = append(got, string(item.Data))
+		_ = item.Ack()
+	}
+	if !reflect.DeepEqual(got, []string{`{"id":"a"}`, `{"id":"b"}`}) {
+		t.Errorf("Stream() = %v", got)
+	}
+}
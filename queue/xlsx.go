@@ -0,0 +1,135 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/xuri/excelize/v2"
+	"io"
+	"path"
+	"strings"
+)
+
+const suffixXlsx = ".xlsx"
+
+// XlsxOptions 는 .xlsx 큐파일을 읽는 방법이다. 한 행이 헤더 행을 키로 하는 JSON 객체 하나가 된다.
+// .xlsx 는 Pos.Offset 이 Pos.Sheet 에서 읽은 행 번호이다.
+type XlsxOptions struct {
+	Sheet     string                // 읽을 시트. 비어있으면 첫 시트이다.
+	HeaderRow int                   // 헤더 행 번호. 기본값은 1 이고, 그 앞의 행은 읽지 않는다.
+	Types     map[string]ColumnType // 컬럼별 타입. 없는 컬럼은 STRING 이다.
+}
+
+func (opts XlsxOptions) validate() error {
+	if opts.HeaderRow < 0 {
+		return fmt.Errorf("invalid Xlsx.HeaderRow %d", opts.HeaderRow)
+	}
+	return validateColumnTypes("Xlsx", opts.Types)
+}
+
+func (opts XlsxOptions) headerRow() int64 {
+	if opts.HeaderRow == 0 {
+		return 1
+	}
+	return int64(opts.HeaderRow)
+}
+
+// openXlsxReader 는 헤더 행까지 읽고 pos 번째 행 다음부터 읽는다.
+// 통합문서는 다 쓰인 뒤에 들어오므로 줄바꿈을 기다리는 일은 없다.
+func (fq *FileQueue) openXlsxReader(pos int64) (queueReader, error) {
+	book, err := excelize.OpenFile(path.Join(fq.QueuePath, fq.FileQueueName))
+	if err != nil {
+		return nil, err
+	}
+	sheet := fq.xlsx.Sheet
+	if sheet == "" {
+		sheet = book.GetSheetName(0)
+	}
+	// 다른 시트를 읽던 위치로 이어서 읽으면 엉뚱한 행부터 읽게 된다.
+	if fq.Pos.Sheet != "" && fq.Pos.Sheet != sheet {
+		book.Close()
+		return nil, fmt.Errorf("pos is for sheet %q, not %q", fq.Pos.Sheet, sheet)
+	}
+	fq.Pos.Sheet = sheet
+	rows, err := book.Rows(sheet)
+	if err != nil {
+		book.Close()
+		return nil, err
+	}
+	r := &xlsxReader{book: book, rows: rows, types: fq.xlsx.Types}
+	headerRow := fq.xlsx.headerRow()
+	for r.pos < headerRow {
+		if !rows.Next() {
+			return r, nil
+		}
+		r.pos++
+	}
+	header, err := rows.Columns()
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	r.columns = header
+	for r.pos < pos {
+		if !rows.Next() {
+			break
+		}
+		r.pos++
+	}
+	return r, nil
+}
+
+type xlsxReader struct {
+	book    *excelize.File
+	rows    *excelize.Rows
+	pos     int64
+	columns []string
+	types   map[string]ColumnType
+}
+
+func (r *xlsxReader) Next() ([]byte, int64, error) {
+	if !r.rows.Next() {
+		if err := r.rows.Error(); err != nil {
+			return nil, r.pos, err
+		}
+		return nil, r.pos, io.EOF
+	}
+	r.pos++
+	cells, err := r.rows.Columns()
+	if err != nil {
+		return nil, r.pos, err
+	}
+	if strings.TrimSpace(strings.Join(cells, "")) == "" {
+		return []byte{}, r.pos, nil
+	}
+	data, err := r.toJson(cells)
+	if err != nil {
+		// 변환하지 못한 행은 셀 값을 탭으로 이어서 돌려준다. dead letter 에 원본과 이유가 남는다.
+		return []byte(strings.Join(cells, "\t")), r.pos, &RowError{Err: err}
+	}
+	return data, r.pos, nil
+}
+
+func (r *xlsxReader) toJson(cells []string) ([]byte, error) {
+	obj := make(map[string]interface{}, len(cells))
+	for i, cell := range cells {
+		var column string
+		if i < len(r.columns) {
+			column = strings.TrimSpace(r.columns[i])
+		}
+		// 헤더가 비어있는 컬럼은 A, B, C ... 로 부른다.
+		if column == "" {
+			column, _ = excelize.ColumnNumberToName(i + 1)
+		}
+		var err error
+		obj[column], err = r.types[column].convert(cell)
+		if err != nil {
+			return nil, fmt.Errorf("%s - %v", column, err)
+		}
+	}
+	return json.Marshal(obj)
+}
+
+func (r *xlsxReader) Close() error {
+	r.rows.Close()
+	return r.book.Close()
+}
@@ -0,0 +1,47 @@
+package queue
+
+import (
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestFileQueue_TakeXlsx(t *testing.T) {
+	queuePath := path.Join(testBase, "xlsx_test1")
+	opts := XlsxOptions{Sheet: "Orders", HeaderRow: 2, Types: map[string]ColumnType{"qty": ColumnTypeInteger}}
+	takes := []int{1, 10}
+	want := [][]string{
+		{`{"D":"x","name":"Kim","qty":3,"uuid":"1"}`},
+		{"2\tLee\tmany", `{"name":"Park","qty":5,"uuid":"3"}`},
+	}
+	for i, n := range takes {
+		// 매번 새로 열어도 시트와 행 번호로 이어서 읽는다.
+		fq, err := NewFileQueue(queuePath, "data.xlsx")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fq.xlsx = opts
+		var got []string
+		for _, data := range fq.Take(n) {
+			got = append(got, string(data))
+		}
+		fq.Close()
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("Take() = %q, want %q", got, want[i])
+		}
+	}
+
+	fq, err := NewFileQueue(queuePath, "data.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fq.Pos.Sheet != "Orders" || fq.Pos.Offset != 6 || !fq.IsEOF() {
+		t.Errorf("Pos = %#v", fq.Pos)
+	}
+
+	// 다른 시트로 바꾸면 이어서 읽지 않는다.
+	fq.xlsx = XlsxOptions{}
+	if got := fq.Take(10); len(got) != 0 || fq.Pos.LastError == "" {
+		t.Errorf("Take() = %s, Pos = %#v", got, fq.Pos)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"lazyboy/queue"
+	"sync"
+	"time"
+)
+
+// pipeRuns 는 이 프로세스 안에서 파이프라인마다 proc 이 하나씩만 돌게 한다.
+// 다른 프로세스와는 파이프라인 디렉토리의 잠금파일로 막는다.
+type pipeRuns struct {
+	mu       sync.Mutex
+	runs     map[string]*pipeRun
+	interval time.Duration
+	start    time.Time // 티커를 만든 때. 티커 간격은 여기서부터 센다.
+	budgets  map[string]*takeBudget
+}
+
+type pipeRun struct {
+	cancel  context.CancelFunc
+	done    chan struct{}
+	waiting bool // QUEUE 정책으로 이 실행을 기다리는 proc 이 있다.
+}
+
+// takeBudget 은 한 티커 간격 동안 가져간 건수이다.
+type takeBudget struct {
+	window time.Time
+	used   int
+}
+
+// newPipeRuns 는 티커를 만들기 직전에 불러야 티커 간격이 티커와 맞는다.
+func newPipeRuns(interval time.Duration) *pipeRuns {
+	return &pipeRuns{runs: map[string]*pipeRun{}, interval: interval, start: time.Now(), budgets: map[string]*takeBudget{}}
+}
+
+// budget 은 이번 티커 간격에 더 가져갈 수 있는 건수이다.
+// 티커가 울릴 때마다 새 간격이 시작되고, 그 간격 안의 실행들이 perTick 을 나눠 쓴다.
+func (r *pipeRuns) budget(pipePath string, perTick int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.budgetAt(pipePath, perTick, time.Now())
+}
+
+func (r *pipeRuns) budgetAt(pipePath string, perTick int, now time.Time) int {
+	window := r.start.Add(now.Sub(r.start) / r.interval * r.interval)
+	b, ok := r.budgets[pipePath]
+	if !ok || !b.window.Equal(window) {
+		b = &takeBudget{window: window}
+		r.budgets[pipePath] = b
+	}
+	if b.used >= perTick {
+		return 0
+	}
+	return perTick - b.used
+}
+
+func (r *pipeRuns) use(pipePath string, n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if b, ok := r.budgets[pipePath]; ok {
+		b.used += n
+	}
+}
+
+// begin 은 정책에 따라 이전 실행을 건너뛰거나 기다리거나 취소시킨 뒤 실행을 등록한다.
+// 돌려받는 context 는 CANCEL 로 취소될 때만 끝나고, 종료시그널로는 끝나지 않는다.
+func (r *pipeRuns) begin(ctx context.Context, pipePath string, policy queue.OverlapPolicy) (context.Context, func(), bool) {
+	for {
+		r.mu.Lock()
+		prev, running := r.runs[pipePath]
+		if !running {
+			runCtx, cancel := context.WithCancel(context.Background())
+			run := &pipeRun{cancel: cancel, done: make(chan struct{})}
+			r.runs[pipePath] = run
+			r.mu.Unlock()
+			return runCtx, func() {
+				r.mu.Lock()
+				delete(r.runs, pipePath)
+				r.mu.Unlock()
+				cancel()
+				close(run.done)
+			}, true
+		}
+		switch policy {
+		case queue.OverlapQueue:
+			// 기다리는 것은 하나면 충분하다.
+			if prev.waiting {
+				r.mu.Unlock()
+				return nil, nil, false
+			}
+			prev.waiting = true
+		case queue.OverlapCancel:
+			prev.cancel()
+		default:
+			r.mu.Unlock()
+			return nil, nil, false
+		}
+		r.mu.Unlock()
+
+		select {
+		case <-prev.done:
+		case <-ctx.Done():
+			return nil, nil, false
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"lazyboy/queue"
+	"testing"
+	"time"
+)
+
+type beginResult struct {
+	ctx context.Context
+	end func()
+	ok  bool
+}
+
+func beginAsync(runs *pipeRuns, ctx context.Context, policy queue.OverlapPolicy) chan beginResult {
+	ch := make(chan beginResult, 1)
+	go func() {
+		runCtx, end, ok := runs.begin(ctx, "pipe", policy)
+		ch <- beginResult{runCtx, end, ok}
+	}()
+	return ch
+}
+
+// waitWaiting 은 QUEUE 로 들어온 proc 이 이전 실행을 기다리기 시작할 때까지 기다린다.
+func waitWaiting(t *testing.T, runs *pipeRuns) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		runs.mu.Lock()
+		waiting := runs.runs["pipe"] != nil && runs.runs["pipe"].waiting
+		runs.mu.Unlock()
+		if waiting {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("not waiting")
+}
+
+func TestPipeRunsSkip(t *testing.T) {
+	runs := newPipeRuns(time.Minute)
+	_, end, ok := runs.begin(context.Background(), "pipe", queue.OverlapSkip)
+	if !ok {
+		t.Fatal("begin() = false")
+	}
+	if _, _, ok := runs.begin(context.Background(), "pipe", queue.OverlapSkip); ok {
+		t.Error("begin() while running = true")
+	}
+	// 다른 파이프라인은 막지 않는다.
+	_, endOther, ok := runs.begin(context.Background(), "other", queue.OverlapSkip)
+	if !ok {
+		t.Error("begin() of other pipeline = false")
+	} else {
+		endOther()
+	}
+	end()
+	_, end, ok = runs.begin(context.Background(), "pipe", queue.OverlapSkip)
+	if !ok {
+		t.Fatal("begin() after end = false")
+	}
+	end()
+}
+
+func TestPipeRunsQueue(t *testing.T) {
+	runs := newPipeRuns(time.Minute)
+	firstCtx, end, ok := runs.begin(context.Background(), "pipe", queue.OverlapQueue)
+	if !ok {
+		t.Fatal("begin() = false")
+	}
+
+	second := beginAsync(runs, context.Background(), queue.OverlapQueue)
+	waitWaiting(t, runs)
+
+	// 기다리는 것은 하나뿐이다.
+	if _, _, ok := runs.begin(context.Background(), "pipe", queue.OverlapQueue); ok {
+		t.Error("begin() of the second waiter = true")
+	}
+	select {
+	case <-second:
+		t.Fatal("begin() returned before the previous run ends")
+	case <-time.After(time.Millisecond * 100):
+	}
+	if firstCtx.Err() != nil {
+		t.Error("QUEUE canceled the previous run")
+	}
+
+	end()
+	r := <-second
+	if !r.ok {
+		t.Fatal("begin() after the previous run ends = false")
+	}
+
+	// 기다리다 종료되면 실행하지 않는다.
+	ctx, cancel := context.WithCancel(context.Background())
+	third := beginAsync(runs, ctx, queue.OverlapQueue)
+	waitWaiting(t, runs)
+	cancel()
+	if r := <-third; r.ok {
+		t.Error("begin() after ctx is done = true")
+	}
+	r.end()
+}
+
+func TestPipeRunsCancel(t *testing.T) {
+	runs := newPipeRuns(time.Minute)
+	firstCtx, end, ok := runs.begin(context.Background(), "pipe", queue.OverlapCancel)
+	if !ok {
+		t.Fatal("begin() = false")
+	}
+
+	second := beginAsync(runs, context.Background(), queue.OverlapCancel)
+	select {
+	case <-firstCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("CANCEL did not cancel the previous run")
+	}
+
+	// 취소된 실행이 끝날 때까지는 시작하지 않는다.
+	select {
+	case <-second:
+		t.Fatal("begin() returned before the previous run ends")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	end()
+	r := <-second
+	if !r.ok {
+		t.Fatal("begin() after the previous run ends = false")
+	}
+	if r.ctx.Err() != nil {
+		t.Errorf("new run ctx = %v", r.ctx.Err())
+	}
+	r.end()
+}
+
+func TestPipeRunsBudget(t *testing.T) {
+	runs := newPipeRuns(time.Minute)
+	at := func(d time.Duration) time.Time { return runs.start.Add(d) }
+
+	// 티커 전에 파일 변경으로 돈 실행과 티커로 돈 실행이 같은 간격을 나눠 쓴다.
+	if n := runs.budgetAt("pipe", 10, at(time.Second*10)); n != 10 {
+		t.Errorf("budget = %v, want 10", n)
+	}
+	runs.use("pipe", 4)
+	if n := runs.budgetAt("pipe", 10, at(time.Second*50)); n != 6 {
+		t.Errorf("budget = %v, want 6", n)
+	}
+	runs.use("pipe", 6)
+	if n := runs.budgetAt("pipe", 10, at(time.Second*59)); n != 0 {
+		t.Errorf("budget = %v, want 0", n)
+	}
+
+	// 티커가 울리면 새 간격이다.
+	if n := runs.budgetAt("pipe", 10, at(time.Minute)); n != 10 {
+		t.Errorf("budget at tick = %v, want 10", n)
+	}
+	runs.use("pipe", 10)
+	if n := runs.budgetAt("pipe", 10, at(time.Minute+time.Second*30)); n != 0 {
+		t.Errorf("budget after tick = %v, want 0", n)
+	}
+	if n := runs.budgetAt("other", 10, at(time.Minute+time.Second*30)); n != 10 {
+		t.Errorf("budget of other pipeline = %v, want 10", n)
+	}
+}
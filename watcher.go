@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+	"lazyboy/queue"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// watchDebounce 동안 같은 파이프라인에 생긴 변경은 한번으로 합친다.
+const watchDebounce = time.Millisecond * 200
+
+// watchPipelines 는 파이프라인 디렉토리에 큐파일이 생기거나 덧붙여지면 그 디렉토리를 보낸다.
+// 새로 생긴 파이프라인 디렉토리도 따라서 본다.
+func watchPipelines(ctx context.Context, pipeBasePath string) (<-chan string, error) {
+	logger := logrus.WithContext(ctx)
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	err = watcher.Add(pipeBasePath)
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	dirs, err := os.ReadDir(pipeBasePath)
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	for _, dir := range dirs {
+		if dir.IsDir() {
+			watchPipelineDir(ctx, watcher, filepath.Join(pipeBasePath, dir.Name()))
+		}
+	}
+
+	changed := make(chan string)
+	fire := make(chan string)
+	go func() {
+		defer watcher.Close()
+		var mu sync.Mutex
+		pending := map[string]bool{}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Warnf("Watch error - %v", err)
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				dir := filepath.Dir(ev.Name)
+				if dir == pipeBasePath {
+					if ev.Op&fsnotify.Create != 0 {
+						if stat, err := os.Stat(ev.Name); err == nil && stat.IsDir() {
+							watchPipelineDir(ctx, watcher, ev.Name)
+						}
+					}
+					continue
+				}
+				if filepath.Dir(dir) == pipeBasePath && filepath.Base(ev.Name) == queue.InboxDir {
+					if ev.Op&fsnotify.Create != 0 {
+						watchDir(ctx, watcher, ev.Name)
+					}
+					continue
+				}
+				// inbox/ 에 들어온 파일은 그 파이프라인을 돌린다.
+				if filepath.Base(dir) == queue.InboxDir && filepath.Dir(filepath.Dir(dir)) == pipeBasePath {
+					if ev.Op&fsnotify.Create == 0 || !queue.IsInboxFileName(filepath.Base(ev.Name)) {
+						continue
+					}
+					dir = filepath.Dir(dir)
+				} else if ev.Op&(fsnotify.Create|fsnotify.Write) == 0 || !queue.IsQueueFileName(filepath.Base(ev.Name)) {
+					continue
+				}
+				mu.Lock()
+				if !pending[dir] {
+					pending[dir] = true
+					time.AfterFunc(watchDebounce, func() {
+						select {
+						case fire <- dir:
+						case <-ctx.Done():
+						}
+					})
+				}
+				mu.Unlock()
+			case dir := <-fire:
+				mu.Lock()
+				delete(pending, dir)
+				mu.Unlock()
+				select {
+				case changed <- dir:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return changed, nil
+}
+
+// watchPipelineDir 는 파이프라인 디렉토리와, 있으면 그 안의 inbox/ 도 본다.
+func watchPipelineDir(ctx context.Context, watcher *fsnotify.Watcher, pipePath string) {
+	watchDir(ctx, watcher, pipePath)
+	inboxPath := filepath.Join(pipePath, queue.InboxDir)
+	if stat, err := os.Stat(inboxPath); err == nil && stat.IsDir() {
+		watchDir(ctx, watcher, inboxPath)
+	}
+}
+
+func watchDir(ctx context.Context, watcher *fsnotify.Watcher, dirPath string) {
+	logger := logrus.WithContext(ctx)
+	logger.Debugf("Watch %v", dirPath)
+	if err := watcher.Add(dirPath); err != nil {
+		logger.Warnf("Watch failed %v - %v", dirPath, err)
+	}
+}